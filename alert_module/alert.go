@@ -0,0 +1,249 @@
+package alert_module
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/errorpb"
+	"pkg.lucas.icu/micro/viperutil"
+	"pkg.lucas.icu/micro/zap_module"
+)
+
+type Config struct {
+	Rules       []Rule        `mapstructure:"rules" validate:"dive" desc:"notify when errors reach a threshold"`
+	DedupWindow time.Duration `mapstructure:"dedup-window" validate:"gte=0" desc:"an alert fires at most once per error and method in this window"`
+}
+
+// Rule matches errors by code, ID and domain, empty fields match any.
+type Rule struct {
+	Code   string        `mapstructure:"code" desc:"grpc code, e.g. Internal"`
+	ID     string        `mapstructure:"id" desc:"error ID"`
+	Domain string        `mapstructure:"domain" desc:"error domain"`
+	Count  int           `mapstructure:"count" validate:"gt=0" desc:"number of errors in window to fire an alert"`
+	Window time.Duration `mapstructure:"window" validate:"gt=0" desc:"window to count the errors in"`
+}
+
+var DefaultConfig = wrappedCfg{
+	Alert: Config{
+		Rules: []Rule{
+			{Code: "Internal", Count: 10, Window: time.Minute},
+		},
+		DedupWindow: 10 * time.Minute,
+	},
+}
+
+type wrappedCfg struct {
+	Alert Config `mapstructure:"alert"`
+}
+
+func ReadConfig(v *viper.Viper) (Config, error) {
+	cfg := &wrappedCfg{}
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg.Alert, nil
+}
+
+func CheckConfig(cfg Config) error {
+	return validator.New().Struct(&cfg)
+}
+
+// Module provides *Monitor, which grpc_module and http_module use to fire
+// alerts. Errors are counted as metrics without it.
+func Module() fx.Option {
+	return fx.Options(
+		cfg_module.SetDefaultConfig(DefaultConfig),
+		fx.Provide(
+			ReadConfig,
+			NewMonitor,
+		),
+	)
+}
+
+var errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "errorpb_errors_total",
+	Help: "Total number of errors returned by handlers, by code, ID, domain and method.",
+}, []string{"transport", "method", "code", "id", "domain"})
+
+func init() {
+	prometheus.MustRegister(errorsTotal)
+}
+
+type notifiersParams struct {
+	fx.In
+
+	Notifiers []Notifier        `group:"alert_notifiers"`
+	LogCfg    zap_module.Config `optional:"true"`
+}
+
+type notifiers struct {
+	fx.Out
+
+	Notifiers []Notifier `group:"alert_notifiers,flatten"`
+}
+
+// WithNotifiers adds notifiers of the alerts.
+func WithNotifiers(n ...Notifier) fx.Option {
+	return fx.Supply(notifiers{Notifiers: n})
+}
+
+type rule struct {
+	Rule
+	code    codes.Code
+	anyCode bool
+}
+
+type counter struct {
+	start  time.Time
+	window time.Duration
+	count  int
+}
+
+// Monitor counts errors by rule and notifies the notifiers when a threshold
+// is reached. A nil Monitor only counts the errors as metrics.
+type Monitor struct {
+	rules     []rule
+	dedup     time.Duration
+	notifiers []Notifier
+	logger    *zap.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	fired    map[string]time.Time
+	// expired counters and fired alerts are pruned once per pruneEvery
+	pruneEvery time.Duration
+	pruned     time.Time
+}
+
+// NewMonitor creates a Monitor of cfg, log.slack-webhook of zap_module is
+// added as a Slack notifier if set.
+func NewMonitor(cfg Config, p notifiersParams, logger *zap.Logger) (*Monitor, error) {
+	m := &Monitor{
+		dedup:     cfg.DedupWindow,
+		notifiers: p.Notifiers,
+		logger:    logger,
+		now:       time.Now,
+		counters:  map[string]*counter{},
+		fired:     map[string]time.Time{},
+	}
+	if p.LogCfg.SlackWebhook != "" {
+		m.notifiers = append(m.notifiers, NewSlackNotifier(p.LogCfg.SlackWebhook))
+	}
+	for _, r := range cfg.Rules {
+		rl := rule{Rule: r, anyCode: r.Code == ""}
+		if !rl.anyCode {
+			c, err := errorpb.ParseCode(r.Code)
+			if err != nil {
+				return nil, fmt.Errorf("invalid alert rule: %w", err)
+			}
+			rl.code = c
+		}
+		m.rules = append(m.rules, rl)
+		if r.Window > m.pruneEvery {
+			m.pruneEvery = r.Window
+		}
+	}
+	if m.dedup > m.pruneEvery {
+		m.pruneEvery = m.dedup
+	}
+	m.pruned = m.now()
+	return m, nil
+}
+
+func (r rule) match(e *errorpb.Error) bool {
+	return (r.anyCode || codes.Code(e.Code) == r.code) &&
+		(r.ID == "" || r.ID == e.Id) &&
+		(r.Domain == "" || r.Domain == e.Domain)
+}
+
+// Observe counts err returned by method of transport, e.g. grpc or http.
+func (m *Monitor) Observe(ctx context.Context, transport, method string, err error) {
+	if err == nil {
+		return
+	}
+	e := errorpb.MustFromError(err)
+	errorsTotal.WithLabelValues(transport, method, codes.Code(e.Code).String(), e.Id, e.Domain).Inc()
+	if m == nil {
+		return
+	}
+	for i, r := range m.rules {
+		if !r.match(e) {
+			continue
+		}
+		if a, ok := m.count(i, transport, method, e); ok {
+			go m.notify(a)
+		}
+	}
+}
+
+// count counts e for the rule i, and returns the alert to fire if any.
+func (m *Monitor) count(i int, transport, method string, e *errorpb.Error) (Alert, bool) {
+	r := m.rules[i]
+	// alerts are deduplicated by error and method
+	key := fmt.Sprintf("%s|%s|%s|%d|%s", transport, method, e.Domain, e.Code, e.Id)
+	ruleKey := fmt.Sprintf("%d|%s", i, key)
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.pruned) >= m.pruneEvery {
+		m.prune(now)
+	}
+	c, ok := m.counters[ruleKey]
+	if !ok || now.Sub(c.start) > r.Window {
+		c = &counter{start: now, window: r.Window}
+		m.counters[ruleKey] = c
+	}
+	c.count++
+	if c.count < r.Count {
+		return Alert{}, false
+	}
+	delete(m.counters, ruleKey)
+	if last, ok := m.fired[key]; ok && now.Sub(last) < m.dedup {
+		return Alert{}, false
+	}
+	m.fired[key] = now
+	return Alert{
+		Transport: transport,
+		Method:    method,
+		Error:     e,
+		Count:     c.count,
+		Window:    r.Window,
+	}, true
+}
+
+// prune removes the counters whose window expired and the fired alerts out
+// of the dedup window, so that errors seen once do not stay in memory.
+func (m *Monitor) prune(now time.Time) {
+	for key, c := range m.counters {
+		if now.Sub(c.start) > c.window {
+			delete(m.counters, key)
+		}
+	}
+	for key, last := range m.fired {
+		if now.Sub(last) >= m.dedup {
+			delete(m.fired, key)
+		}
+	}
+	m.pruned = now
+}
+
+func (m *Monitor) notify(a Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, n := range m.notifiers {
+		if err := n.Notify(ctx, a); err != nil {
+			m.logger.Warn("failed to notify alert", zap.Error(err))
+		}
+	}
+}
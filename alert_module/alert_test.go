@@ -0,0 +1,62 @@
+package alert_module
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+func TestMonitor(t *testing.T) {
+	alerts := make(chan Alert, 10)
+	m, err := NewMonitor(Config{
+		Rules:       []Rule{{Code: "INTERNAL", Count: 2, Window: time.Minute}},
+		DedupWindow: 10 * time.Minute,
+	}, notifiersParams{Notifiers: []Notifier{NotifierFunc(func(_ context.Context, a Alert) error {
+		alerts <- a
+		return nil
+	})}}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	observe := func(n int, err error) {
+		for i := 0; i < n; i++ {
+			m.Observe(ctx, "grpc", "/pkg.Svc/Get", err)
+		}
+	}
+	observe(3, errorpb.New(codes.NotFound))
+	observe(1, errorpb.New(codes.Internal, "DB"))
+	now = now.Add(2 * time.Minute) // window expired
+	observe(2, errorpb.New(codes.Internal, "DB"))
+
+	select {
+	case a := <-alerts:
+		if a.Error.Id != "DB" || a.Count != 2 {
+			t.Errorf("unexpected alert: %v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert fired")
+	}
+
+	observe(4, errorpb.New(codes.Internal, "DB")) // deduplicated
+	now = now.Add(11 * time.Minute)
+	observe(2, errorpb.New(codes.Internal, "DB"))
+	time.Sleep(50 * time.Millisecond)
+	if len(alerts) != 1 {
+		t.Errorf("got %d alerts after dedup window, want 1", len(alerts))
+	}
+
+	observe(1, errorpb.New(codes.Internal, "CACHE"))
+	now = now.Add(11 * time.Minute) // everything expired
+	observe(1, errorpb.New(codes.Internal, "QUEUE"))
+	if len(m.counters) != 1 || len(m.fired) != 0 {
+		t.Errorf("got %d counters and %d fired alerts after pruning, want 1 and 0", len(m.counters), len(m.fired))
+	}
+}
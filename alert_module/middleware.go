@@ -0,0 +1,40 @@
+package alert_module
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor returns a new unary server interceptor that
+// observes the returned errors with m, which may be nil.
+func UnaryServerInterceptor(m *Monitor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		m.Observe(ctx, "grpc", info.FullMethod, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor that
+// observes the returned errors with m, which may be nil.
+func StreamServerInterceptor(m *Monitor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, stream)
+		m.Observe(stream.Context(), "grpc", info.FullMethod, err)
+		return err
+	}
+}
+
+// EchoMiddleware observes the errors returned by echo handlers with m,
+// which may be nil. The method is the route path.
+func EchoMiddleware(m *Monitor) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			m.Observe(c.Request().Context(), "http", c.Request().Method+" "+c.Path(), err)
+			return err
+		}
+	}
+}
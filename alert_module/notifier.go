@@ -0,0 +1,53 @@
+package alert_module
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+// Alert is fired when errors reach the threshold of a rule.
+type Alert struct {
+	Transport string
+	Method    string
+	// Error is the last error counted.
+	Error  *errorpb.Error
+	Count  int
+	Window time.Duration
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%d %s[%s] errors of %s %s in %s, last: %s",
+		a.Count, codes.Code(a.Error.Code), a.Error.Id, a.Transport, a.Method, a.Window, a.Error.Message)
+}
+
+// Notifier sends alerts, e.g. to Slack.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// NotifierFunc is an adapter to use ordinary functions as Notifier.
+type NotifierFunc func(ctx context.Context, a Alert) error
+
+func (f NotifierFunc) Notify(ctx context.Context, a Alert) error {
+	return f(ctx, a)
+}
+
+type slackNotifier struct {
+	webhook string
+}
+
+// NewSlackNotifier sends alerts to the Slack incoming webhook.
+func NewSlackNotifier(webhook string) Notifier {
+	return &slackNotifier{webhook: webhook}
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, a Alert) error {
+	return slack.PostWebhookContext(ctx, n.webhook, &slack.WebhookMessage{
+		Text: ":rotating_light: " + a.String(),
+	})
+}
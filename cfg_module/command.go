@@ -0,0 +1,73 @@
+package cfg_module
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+)
+
+// RunCommand runs the config subcommand in args against the configs
+// registered by opts, and reports whether args was a config subcommand.
+// The app is built but never started. Supported subcommands:
+//
+//	config schema          print the JSON Schema of the config files
+//	config sample          print a commented sample config file
+//	config dump [format]   print the effective config in yaml or json,
+//	                       sensitive values are redacted
+//
+// Typically used at the beginning of main:
+//
+//	if ok, err := cfg_module.RunCommand(os.Args[1:], os.Stdout, opts...); ok {
+//		...
+//	}
+func RunCommand(args []string, w io.Writer, opts ...fx.Option) (bool, error) {
+	if len(args) < 2 || args[0] != "config" {
+		return false, nil
+	}
+	var run interface{}
+	switch args[1] {
+	case "schema":
+		run = func(p defaultCfgOptionsParams) error {
+			return write(w, JSONSchema, p.Options)
+		}
+	case "sample":
+		run = func(p defaultCfgOptionsParams) error {
+			return write(w, SampleYAML, p.Options)
+		}
+	case "dump":
+		format := ""
+		if len(args) > 2 {
+			format = args[2]
+		}
+		run = func(v *viper.Viper) error {
+			out, err := Dump(v, format)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(out)
+			return err
+		}
+	default:
+		return true, fmt.Errorf("unknown config subcommand: %s", args[1])
+	}
+	app := fx.New(
+		fx.Options(opts...),
+		fx.NopLogger,
+		fx.Invoke(run),
+	)
+	return true, app.Err()
+}
+
+func write(w io.Writer, gen func([]interface{}) ([]byte, error), defaults []interface{}) error {
+	out, err := gen(defaults)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(out); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
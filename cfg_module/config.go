@@ -1,6 +1,8 @@
 package cfg_module
 
 import (
+	"fmt"
+
 	"github.com/spf13/viper"
 	"go.uber.org/fx"
 	"pkg.lucas.icu/micro/viperutil"
@@ -24,26 +26,73 @@ func SetDefaultConfig(in interface{}) fx.Option {
 	return fx.Supply(defaultCfgOptions{Options: in})
 }
 
-func Module(path string) fx.Option {
+// Module reads the config files in order, values in later files override
+// the ones in earlier files. Empty paths are ignored.
+// Use Layers to build the conventional base/profile/local file list.
+// Every config registered with SetDefaultConfig is validated once all files
+// are loaded.
+func Module(paths ...string) fx.Option {
 	return fx.Options(
+		SetDefaultConfig(DefaultConfig),
 		fx.Provide(
-			ReadConfig(path),
+			ReadConfig(paths...),
+		),
+		fx.Invoke(
+			WarnUnknownKeys,
 		),
 	)
 }
 
-func ReadConfig(path string) func(opts defaultCfgOptionsParams) (*viper.Viper, error) {
-	return func(opts defaultCfgOptionsParams) (*viper.Viper, error) {
+func ReadConfig(paths ...string) func(opts defaultCfgOptionsParams, secrets secretProvidersParams) (*viper.Viper, error) {
+	return func(opts defaultCfgOptionsParams, secrets secretProvidersParams) (*viper.Viper, error) {
 		for _, opt := range opts.Options {
 			viperutil.VSetDefault(Viper, opt)
 		}
+		if err := markSensitiveFields(opts.Options); err != nil {
+			return nil, err
+		}
+		// the files are merged together first, so that their values are
+		// matched to the types of earlier files, not of defaults or env
+		files := viper.New()
+		resolver := newSecretResolver(files, secrets.Providers)
 		// only load config once (whether via direct call or fx.Module)
-		if path != "" {
-			Viper.SetConfigFile(path)
-			if err := Viper.ReadInConfig(); err != nil {
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			if err := mergeConfigFile(files, path, resolver); err != nil {
 				return nil, err
 			}
 		}
+		if err := Viper.MergeConfigMap(files.AllSettings()); err != nil {
+			return nil, err
+		}
+		if err := Validate(Viper, opts.Options); err != nil {
+			return nil, err
+		}
 		return Viper, nil
 	}
 }
+
+// mergeConfigFile reads a single config file, expands the environment
+// variable references and resolves the secret references in its values,
+// then merges it into v.
+func mergeConfigFile(v *viper.Viper, path string, secrets *secretResolver) error {
+	fv := viper.New()
+	fv.SetConfigFile(path)
+	if err := fv.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	settings := fv.AllSettings()
+	if err := expandEnv(settings, ""); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := secrets.resolve(settings, ""); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := matchTypes(settings, "", v); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	recordFileSources(settings, "", path)
+	return v.MergeConfigMap(settings)
+}
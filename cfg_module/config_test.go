@@ -0,0 +1,201 @@
+package cfg_module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLayeredConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "base.yaml", "log:\n  level: debug\n  driver: development\nhttp:\n  listen-port: 3000\n")
+	writeFile(t, dir, "prod.yaml", "log:\n  level: info\n  driver: ${LOG_DRIVER:stackdriver}\n")
+	writeFile(t, dir, "local.yaml", "http:\n  listen-port: ${HTTP_PORT}\n")
+	t.Setenv(envProfile, "prod")
+	t.Setenv("HTTP_PORT", "8080")
+
+	v := viper.New()
+	for _, path := range Layers(dir) {
+		if err := mergeConfigFile(v, path, newSecretResolver(v, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := v.GetString("log.level"); got != "info" {
+		t.Errorf("log.level = %q, want info", got)
+	}
+	if got := v.GetString("log.driver"); got != "stackdriver" {
+		t.Errorf("log.driver = %q, want stackdriver", got)
+	}
+	if got := v.GetInt("http.listen-port"); got != 8080 {
+		t.Errorf("http.listen-port = %d, want 8080", got)
+	}
+}
+
+func TestLayeredTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "base.yaml", "svc:\n  port: ${SVC_PORT:8080}\n  admin-port: 9000\n  hosts: [a.local]\n  debug: false\n")
+	writeFile(t, dir, "prod.yaml", "svc:\n  port: 9090\n  admin-port: ${ADMIN_PORT}\n  hosts: ${SVC_HOSTS}\n  debug: ${SVC_DEBUG:true}\n")
+	t.Setenv(envProfile, "prod")
+	t.Setenv("ADMIN_PORT", "9091")
+	t.Setenv("SVC_HOSTS", "b.local,c.local")
+
+	v := viper.New()
+	for _, path := range Layers(dir) {
+		if err := mergeConfigFile(v, path, newSecretResolver(v, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cfg struct {
+		Svc struct {
+			Port      int      `mapstructure:"port"`
+			AdminPort int      `mapstructure:"admin-port"`
+			Hosts     []string `mapstructure:"hosts"`
+			Debug     bool     `mapstructure:"debug"`
+		} `mapstructure:"svc"`
+	}
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if c := cfg.Svc; c.Port != 9090 || c.AdminPort != 9091 || strings.Join(c.Hosts, ",") != "b.local,c.local" || !c.Debug {
+		t.Errorf("svc = %+v", c)
+	}
+
+	writeFile(t, dir, "prod.yaml", "svc:\n  admin-port: ${ADMIN_PORT}\n")
+	t.Setenv("ADMIN_PORT", "admin")
+	v = viper.New()
+	err := mergeConfigFile(v, Layers(dir)[0], newSecretResolver(v, nil))
+	if err == nil {
+		err = mergeConfigFile(v, Layers(dir)[1], newSecretResolver(v, nil))
+	}
+	if err == nil || !strings.Contains(err.Error(), "svc.admin-port") {
+		t.Errorf("mergeConfigFile() = %v, want an error of svc.admin-port", err)
+	}
+}
+
+func TestExpandedStrings(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "base.yaml", "store:\n  password: ${DB_PASSWORD}\n  user: ${DB_USER}\n  port: ${DB_PORT}\n")
+	t.Setenv("DB_PASSWORD", "0123")
+	t.Setenv("DB_USER", "yes")
+	t.Setenv("DB_PORT", "5432")
+
+	v := viper.New()
+	if err := mergeConfigFile(v, path, newSecretResolver(v, nil)); err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Store struct {
+			Password string `mapstructure:"password"`
+			User     string `mapstructure:"user"`
+			Port     int    `mapstructure:"port"`
+		} `mapstructure:"store"`
+	}
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Store.Password != "0123" || cfg.Store.User != "yes" || cfg.Store.Port != 5432 {
+		t.Errorf("store = %+v", cfg.Store)
+	}
+}
+
+func TestMissingEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "base.yaml", "log:\n  slack-webhook: ${MISSING_WEBHOOK}\n")
+
+	err := mergeConfigFile(viper.New(), path, newSecretResolver(viper.New(), nil))
+	if err == nil {
+		t.Fatal("expected error for unset environment variable")
+	}
+	for _, want := range []string{path, "log.slack-webhook", "MISSING_WEBHOOK"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "base.yaml", "db:\n  password: hunter2\n  host: db.local\n")
+
+	v := viper.New()
+	v.SetDefault("db.port", 5432)
+	if err := mergeConfigFile(v, path, newSecretResolver(v, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Dump(v, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "db:\n" +
+		"  host: db.local # file:" + path + "\n" +
+		"  password: '[REDACTED]' # file:" + path + "\n" +
+		"  port: 5432 # default\n"
+	if string(out) != want {
+		t.Errorf("unexpected dump:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestDumpParses(t *testing.T) {
+	v := viper.New()
+	v.SetDefault("dumped.hosts", []string{"a.local"})
+	v.SetDefault("dumped.empty", []string{})
+	v.SetDefault("dumped.labels", map[string]string{"team": "core"})
+	v.SetDefault("dumped.rules", []map[string]interface{}{{"match": "/**", "rate": 0.5}})
+	v.SetDefault("dumped.banner", "line 1\nline 2 # not a comment")
+	v.SetDefault("dumped.unset", nil)
+
+	out, err := Dump(v, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Dumped struct {
+			Hosts  []string
+			Empty  []string
+			Labels map[string]string
+			Rules  []map[string]interface{}
+			Banner string
+		}
+	}
+	if err := yaml3.Unmarshal(out, &got); err != nil {
+		t.Fatalf("dump is not valid yaml: %v\n%s", err, out)
+	}
+	d := got.Dumped
+	if len(d.Hosts) != 1 || d.Hosts[0] != "a.local" || d.Labels["team"] != "core" ||
+		len(d.Rules) != 1 || d.Rules[0]["match"] != "/**" || d.Banner != "line 1\nline 2 # not a comment" {
+		t.Errorf("dump parsed as %+v:\n%s", d, out)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	for key, want := range map[string]bool{
+		"db.password":           true,
+		"log.slack-webhook":     true,
+		"oauth.client-secret":   true,
+		"auth.access_token":     true,
+		"tls.private-key":       true,
+		"secrets.db":            true,
+		"config.secret-timeout": false,
+		"auth.token-ttl":        false,
+		"db.host":               false,
+	} {
+		if got := IsSensitive(key); got != want {
+			t.Errorf("IsSensitive(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package cfg_module
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// sensitivePattern matches keys whose values are redacted even if they are
+// not marked as sensitive: keys with a segment ending in one of the words,
+// e.g. db.password or slack-webhook, but not config.secret-timeout.
+var sensitivePattern = regexp.MustCompile(`(?i)(^|[._-])(secrets?|password|passwd|token|webhook|credentials?|private-key|api-key)($|\.)`)
+
+var (
+	sourceMu     sync.RWMutex
+	fileSources  = map[string]string{}
+	envBindings  = map[string][]string{}
+	flagBindings = map[string]*pflag.Flag{}
+)
+
+// BindEnv binds key to the environment variables (KEY by default) like
+// viper.BindEnv, and records it as the source of key when set.
+func BindEnv(key string, envs ...string) error {
+	if err := Viper.BindEnv(append([]string{key}, envs...)...); err != nil {
+		return err
+	}
+	if len(envs) == 0 {
+		envs = []string{strings.ToUpper(key)}
+	}
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	envBindings[strings.ToLower(key)] = envs
+	return nil
+}
+
+// BindFlag binds key to flag like viper.BindPFlag, and records it as the
+// source of key when the flag is changed.
+func BindFlag(key string, flag *pflag.Flag) error {
+	if err := Viper.BindPFlag(key, flag); err != nil {
+		return err
+	}
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	flagBindings[strings.ToLower(key)] = flag
+	return nil
+}
+
+// recordFileSources records path as the source of every key in settings.
+func recordFileSources(settings map[string]interface{}, prefix, path string) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	recordFileSourcesLocked(settings, prefix, path)
+}
+
+func recordFileSourcesLocked(settings map[string]interface{}, prefix, path string) {
+	for k, v := range settings {
+		key := joinKey(prefix, k)
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+			recordFileSourcesLocked(sub, key, path)
+			continue
+		}
+		fileSources[key] = SourceFile + ":" + path
+	}
+}
+
+// Source returns where the effective value of key comes from, following
+// the precedence of viper: flag, env, file, default.
+func Source(key string) string {
+	key = strings.ToLower(key)
+	sourceMu.RLock()
+	defer sourceMu.RUnlock()
+	if flag, ok := flagBindings[key]; ok && flag.Changed {
+		return SourceFlag + ":--" + flag.Name
+	}
+	for _, env := range envBindings[key] {
+		if _, ok := os.LookupEnv(env); ok {
+			return SourceEnv + ":" + env
+		}
+	}
+	if src, ok := fileSources[key]; ok {
+		return src
+	}
+	return SourceDefault
+}
+
+// Setting is the effective value of a config key.
+type Setting struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Settings returns the effective value and source of every key in v,
+// sensitive values are redacted.
+func Settings(v *viper.Viper) map[string]Setting {
+	settings := map[string]Setting{}
+	for _, key := range v.AllKeys() {
+		s := Setting{Value: v.Get(key), Source: Source(key)}
+		if IsSensitive(key) {
+			s.Value = RedactedValue
+		}
+		settings[key] = s
+	}
+	return settings
+}
+
+// Dump prints the effective config of v in yaml or json, annotated with
+// the source of each key. Sensitive values are redacted.
+func Dump(v *viper.Viper, format string) ([]byte, error) {
+	settings := Settings(v)
+	switch format {
+	case "json":
+		return json.MarshalIndent(settings, "", "  ")
+	case "", "yaml":
+		return dumpYAML(settings)
+	default:
+		return nil, fmt.Errorf("unknown config dump format: %s", format)
+	}
+}
+
+func dumpYAML(settings map[string]Setting) ([]byte, error) {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	var parents []string
+	for _, key := range keys {
+		path := strings.Split(key, ".")
+		// skip the parents already written by the previous key
+		common := 0
+		for common < len(parents) && common < len(path)-1 && parents[common] == path[common] {
+			common++
+		}
+		for i := common; i < len(path)-1; i++ {
+			fmt.Fprintf(buf, "%s%s:\n", strings.Repeat("  ", i), path[i])
+		}
+		parents = path[:len(path)-1]
+
+		indent := strings.Repeat("  ", len(path)-1)
+		s := settings[key]
+		out, err := yaml.Marshal(s.Value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %s: %w", key, err)
+		}
+		val := strings.TrimSuffix(string(out), "\n")
+		if s.Value == nil {
+			fmt.Fprintf(buf, "%s%s: # %s\n", indent, path[len(path)-1], s.Source)
+			continue
+		}
+		// collections are written as blocks, `key: - a # source` is invalid
+		if strings.Contains(val, "\n") || isCollection(s.Value) && val != "[]" && val != "{}" {
+			fmt.Fprintf(buf, "%s%s: # %s\n", indent, path[len(path)-1], s.Source)
+			for _, line := range strings.Split(val, "\n") {
+				fmt.Fprintf(buf, "%s  %s\n", indent, line)
+			}
+			continue
+		}
+		fmt.Fprintf(buf, "%s%s: %s # %s\n", indent, path[len(path)-1], val, s.Source)
+	}
+	return buf.Bytes(), nil
+}
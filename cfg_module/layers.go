@@ -0,0 +1,188 @@
+package cfg_module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	envProfile = "CONFIG_PROFILE"
+)
+
+// Profile returns the config profile selected by the CONFIG_PROFILE
+// environment variable, e.g. dev, staging or prod.
+func Profile() string {
+	return os.Getenv(envProfile)
+}
+
+// Layers returns the conventional layered config files in dir:
+// base.yaml, then <profile>.yaml if a profile is selected, then local.yaml
+// if it exists. The profile file is required once a profile is selected.
+func Layers(dir string) []string {
+	files := []string{filepath.Join(dir, "base.yaml")}
+	if profile := Profile(); profile != "" {
+		files = append(files, filepath.Join(dir, profile+".yaml"))
+	}
+	local := filepath.Join(dir, "local.yaml")
+	if _, err := os.Stat(local); err == nil {
+		files = append(files, local)
+	}
+	return files
+}
+
+// envRef matches ${NAME} and ${NAME:default}.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// expandEnv replaces environment variable references in every string value
+// of m in place. prefix is the key path of m, used in error messages.
+func expandEnv(m map[string]interface{}, prefix string) (err error) {
+	for k, v := range m {
+		if m[k], err = expandEnvValue(v, joinKey(prefix, k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expandEnvValue(v interface{}, key string) (_ interface{}, err error) {
+	switch val := v.(type) {
+	case string:
+		out, err := expandEnvString(val, key)
+		if err != nil {
+			return nil, err
+		}
+		// expanded values stay strings, e.g. a password of 0123 or yes, the
+		// weakly typed decoding of viper turns "8080" into an int.
+		return out, nil
+	case map[string]interface{}:
+		return val, expandEnv(val, key)
+	case []interface{}:
+		for i, item := range val {
+			if val[i], err = expandEnvValue(item, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return nil, err
+			}
+		}
+		return val, nil
+	}
+	return v, nil
+}
+
+// matchTypes converts the values of m to the type of the same key in the
+// earlier files merged into files, since viper drops a value whose type
+// differs from the earlier one, e.g. `port: 9090` over `port: ${PORT:8080}`,
+// which is a string after expansion. Scalars become strings over strings,
+// strings are parsed over numbers and bools, and strings are split on
+// commas over lists. Other mismatches are errors.
+func matchTypes(m map[string]interface{}, prefix string, files *viper.Viper) error {
+	for k, val := range m {
+		key := joinKey(prefix, k)
+		if sub, ok := val.(map[string]interface{}); ok {
+			if err := matchTypes(sub, key, files); err != nil {
+				return err
+			}
+		}
+		if !files.IsSet(key) {
+			continue
+		}
+		typed, err := matchType(val, files.Get(key))
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		m[k] = typed
+	}
+	return nil
+}
+
+// matchType converts val to the type of earlier.
+func matchType(val, earlier interface{}) (interface{}, error) {
+	if val == nil || earlier == nil || reflect.TypeOf(val) == reflect.TypeOf(earlier) {
+		return val, nil
+	}
+	var (
+		typed interface{}
+		err   error
+	)
+	s, isString := val.(string)
+	switch earlier.(type) {
+	case string:
+		switch val.(type) {
+		case int, int64, float64, bool:
+			return fmt.Sprint(val), nil
+		}
+	case int:
+		switch v := val.(type) {
+		case string:
+			typed, err = strconv.Atoi(s)
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+	case int64:
+		switch v := val.(type) {
+		case string:
+			typed, err = strconv.ParseInt(s, 10, 64)
+		case int:
+			return int64(v), nil
+		}
+	case float64:
+		switch v := val.(type) {
+		case string:
+			typed, err = strconv.ParseFloat(s, 64)
+		case int:
+			return float64(v), nil
+		}
+	case bool:
+		if isString {
+			typed, err = strconv.ParseBool(s)
+		}
+	case []interface{}:
+		if isString {
+			items := []interface{}{}
+			for _, item := range strings.Split(s, ",") {
+				items = append(items, item)
+			}
+			return items, nil
+		}
+	}
+	if typed == nil && err == nil {
+		return nil, fmt.Errorf("cannot override a %T of an earlier file with the %T %v", earlier, val, val)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot override a %T of an earlier file with %q", earlier, s)
+	}
+	return typed, nil
+}
+
+func expandEnvString(s, key string) (string, error) {
+	var missing []string
+	out := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		sub := envRef.FindStringSubmatch(ref)
+		if val, ok := os.LookupEnv(sub[1]); ok {
+			return val
+		}
+		if strings.Contains(ref, ":") {
+			return sub[2]
+		}
+		missing = append(missing, sub[1])
+		return ref
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("key %q: environment variable %s is not set and has no default", key, strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,434 @@
+package cfg_module
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"pkg.lucas.icu/micro/viperutil"
+)
+
+// durationPattern matches the values accepted by time.ParseDuration.
+const durationPattern = `^[-+]?(0|([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+// field describes a config key, built from the registered default configs.
+// Use the `desc` struct tag to document a config field.
+type field struct {
+	key       string
+	typ       reflect.Type
+	def       interface{} // default value, as set into viper
+	desc      string
+	sensitive bool     // sensitive tag
+	rules     []string // validate tag
+	children  []*field // struct fields
+}
+
+func (f *field) child(key string) *field {
+	for _, c := range f.children {
+		if c.key == key {
+			return c
+		}
+	}
+	c := &field{key: key}
+	f.children = append(f.children, c)
+	return c
+}
+
+// configTree merges the defaults into a single tree, top level keys are
+// sorted as registration order is not stable.
+func configTree(defaults []interface{}) (*field, error) {
+	root := &field{}
+	for _, d := range defaults {
+		if err := buildField(root, reflect.ValueOf(d)); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(root.children, func(i, j int) bool {
+		return root.children[i].key < root.children[j].key
+	})
+	return root, nil
+}
+
+func buildField(f *field, val reflect.Value) error {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val = reflect.New(val.Type().Elem())
+		}
+		val = val.Elem()
+	}
+	f.typ = val.Type()
+	if val.Kind() != reflect.Struct || viperutil.IsTextType(f.typ) {
+		def, err := viperutil.Decode(val.Interface())
+		if err != nil {
+			return err
+		}
+		f.def = def
+		return nil
+	}
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("mapstructure"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "squash") {
+			if err := buildField(f, val.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		c := f.child(strings.ToLower(name))
+		c.desc = sf.Tag.Get("desc")
+		c.sensitive = sf.Tag.Get("sensitive") == "true"
+		if rules := sf.Tag.Get("validate"); rules != "" {
+			c.rules = strings.Split(rules, ",")
+		}
+		if err := buildField(c, val.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markSensitiveFields marks the keys of the fields tagged with
+// `sensitive:"true"` as sensitive.
+func markSensitiveFields(defaults []interface{}) error {
+	root, err := configTree(defaults)
+	if err != nil {
+		return err
+	}
+	var mark func(f *field, prefix string)
+	mark = func(f *field, prefix string) {
+		for _, c := range f.children {
+			key := joinKey(prefix, c.key)
+			if c.sensitive {
+				MarkSensitive(key)
+			}
+			mark(c, key)
+		}
+	}
+	mark(root, "")
+	return nil
+}
+
+// JSONSchema returns a JSON Schema (draft-07) of the config files accepted
+// by the defaults, including their types, defaults and validate rules.
+func JSONSchema(defaults []interface{}) ([]byte, error) {
+	root, err := configTree(defaults)
+	if err != nil {
+		return nil, err
+	}
+	schema := fieldSchema(root)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func fieldSchema(f *field) map[string]interface{} {
+	s := typeSchema(f.typ)
+	if f.desc != "" {
+		s["description"] = f.desc
+	}
+	if len(f.children) > 0 {
+		props := map[string]interface{}{}
+		required := []string{}
+		for _, c := range f.children {
+			props[c.key] = fieldSchema(c)
+			if hasRule(c.rules, "required") {
+				required = append(required, c.key)
+			}
+		}
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	if f.def != nil {
+		s["default"] = f.def
+	}
+	if constraints := ruleSchema(f.typ, f.rules); len(constraints) > 0 {
+		if hasRule(f.rules, "omitempty") {
+			// constraints only apply to non-empty values
+			var zero interface{} = ""
+			if !viperutil.IsTextType(f.typ) {
+				zero = reflect.Zero(f.typ).Interface()
+			}
+			s["anyOf"] = []interface{}{
+				map[string]interface{}{"const": zero},
+				constraints,
+			}
+		} else {
+			for k, v := range constraints {
+				s[k] = v
+			}
+		}
+	}
+	return s
+}
+
+func typeSchema(typ reflect.Type) map[string]interface{} {
+	if typ == nil {
+		return map[string]interface{}{}
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+	if viperutil.IsTextType(typ) {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": elemSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": elemSchema(typ.Elem())}
+	}
+	return map[string]interface{}{}
+}
+
+func elemSchema(typ reflect.Type) map[string]interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct && !viperutil.IsTextType(typ) {
+		f := &field{}
+		_ = buildField(f, reflect.New(typ).Elem())
+		s := fieldSchema(f)
+		removeDefaults(s)
+		return s
+	}
+	return typeSchema(typ)
+}
+
+// removeDefaults drops the zero defaults of a struct used as slice or map
+// element, they are not defaults of the config.
+func removeDefaults(s map[string]interface{}) {
+	delete(s, "default")
+	if props, ok := s["properties"].(map[string]interface{}); ok {
+		for _, p := range props {
+			removeDefaults(p.(map[string]interface{}))
+		}
+	}
+}
+
+// ruleSchema translates the validate rules into JSON Schema keywords, rules
+// without an equivalent keyword are ignored.
+func ruleSchema(typ reflect.Type, rules []string) map[string]interface{} {
+	s := map[string]interface{}{}
+	isString := typ != nil && typ.Kind() == reflect.String
+	isList := typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map)
+	for _, rule := range rules {
+		tag, param, _ := strings.Cut(rule, "=")
+		num, numErr := strconv.ParseFloat(param, 64)
+		switch {
+		case tag == "oneof":
+			enum := []interface{}{}
+			for _, v := range strings.Fields(param) {
+				enum = append(enum, v)
+			}
+			s["enum"] = enum
+		case tag == "url" || tag == "uri":
+			s["format"] = "uri"
+		case tag == "email" || tag == "hostname" || tag == "ipv4" || tag == "ipv6":
+			s["format"] = tag
+		case tag == "ip":
+			s["anyOf"] = []interface{}{
+				map[string]interface{}{"format": "ipv4"},
+				map[string]interface{}{"format": "ipv6"},
+			}
+		case numErr != nil:
+		case isString && (tag == "min" || tag == "gte"):
+			s["minLength"] = num
+		case isString && (tag == "max" || tag == "lte"):
+			s["maxLength"] = num
+		case isString && tag == "len":
+			s["minLength"], s["maxLength"] = num, num
+		case isList && (tag == "min" || tag == "gte"):
+			s["minItems"] = num
+		case isList && (tag == "max" || tag == "lte"):
+			s["maxItems"] = num
+		case tag == "min" || tag == "gte":
+			s["minimum"] = num
+		case tag == "max" || tag == "lte":
+			s["maximum"] = num
+		case tag == "gt":
+			s["exclusiveMinimum"] = num
+		case tag == "lt":
+			s["exclusiveMaximum"] = num
+		}
+	}
+	return s
+}
+
+func hasRule(rules []string, tag string) bool {
+	for _, rule := range rules {
+		if t, _, _ := strings.Cut(rule, "="); t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SampleYAML returns a config file with every key set to its default value,
+// each key is commented with its description, type and validate rules.
+func SampleYAML(defaults []interface{}) ([]byte, error) {
+	root, err := configTree(defaults)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	for i, c := range root.children {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		if err := writeSample(buf, c, ""); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeSample(buf *bytes.Buffer, f *field, indent string) error {
+	if f.desc != "" {
+		fmt.Fprintf(buf, "%s# %s\n", indent, f.desc)
+	}
+	if len(f.children) > 0 {
+		fmt.Fprintf(buf, "%s%s:\n", indent, f.key)
+		for _, c := range f.children {
+			if err := writeSample(buf, c, indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	comment := "type: " + typeName(f.typ)
+	if len(f.rules) > 0 {
+		comment += ", validate: " + strings.Join(f.rules, ",")
+	}
+	fmt.Fprintf(buf, "%s# %s\n", indent, comment)
+	if typ := itemType(f.typ); typ != nil {
+		fmt.Fprintf(buf, "%s# items:\n", indent)
+		writeItemSample(buf, typ, indent+"#   ")
+	}
+
+	out, err := yaml.Marshal(f.def)
+	if err != nil {
+		return fmt.Errorf("unable to marshal default of %s: %w", f.key, err)
+	}
+	val := strings.TrimSuffix(string(out), "\n")
+	switch {
+	case f.def == nil:
+		fmt.Fprintf(buf, "%s%s:\n", indent, f.key)
+	case strings.Contains(val, "\n") || isCollection(f.def) && val != "[]" && val != "{}":
+		fmt.Fprintf(buf, "%s%s:\n", indent, f.key)
+		for _, line := range strings.Split(val, "\n") {
+			fmt.Fprintf(buf, "%s  %s\n", indent, line)
+		}
+	default:
+		fmt.Fprintf(buf, "%s%s: %s\n", indent, f.key, val)
+	}
+	return nil
+}
+
+// itemType returns the struct type of the items of a list or map, nil if
+// they are not structs.
+func itemType(typ reflect.Type) reflect.Type {
+	if typ == nil {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+	default:
+		return nil
+	}
+	typ = typ.Elem()
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || viperutil.IsTextType(typ) {
+		return nil
+	}
+	return typ
+}
+
+// writeItemSample writes the fields of the struct items of a list or map as
+// comments, since they have no defaults.
+func writeItemSample(buf *bytes.Buffer, typ reflect.Type, indent string) {
+	f := &field{}
+	_ = buildField(f, reflect.New(typ).Elem())
+	for _, c := range f.children {
+		line := indent + c.key + ": " + typeName(c.typ)
+		if len(c.rules) > 0 {
+			line += ", validate: " + strings.Join(c.rules, ",")
+		}
+		if c.desc != "" {
+			line += " - " + c.desc
+		}
+		fmt.Fprintln(buf, line)
+		if len(c.children) > 0 {
+			writeItemSample(buf, c.typ, indent+"  ")
+		} else if typ := itemType(c.typ); typ != nil {
+			writeItemSample(buf, typ, indent+"  ")
+		}
+	}
+}
+
+func isCollection(v interface{}) bool {
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func typeName(typ reflect.Type) string {
+	if typ == nil {
+		return "any"
+	}
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct && !viperutil.IsTextType(typ) {
+		return "object"
+	}
+	if t, ok := typeSchema(typ)["type"].(string); ok {
+		if t == "array" {
+			return "list of " + typeName(typ.Elem())
+		}
+		if t == "object" {
+			return "map of " + typeName(typ.Elem())
+		}
+		return t
+	}
+	return "any"
+}
@@ -0,0 +1,93 @@
+package cfg_module
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+type testSchemaCfg struct {
+	App struct {
+		Name     string            `mapstructure:"name" validate:"required,min=1" desc:"name of the app"`
+		Timeout  time.Duration     `mapstructure:"timeout" validate:"gt=0"`
+		Endpoint string            `mapstructure:"endpoint" validate:"omitempty,url"`
+		Password string            `mapstructure:"password" sensitive:"true"`
+		Labels   map[string]string `mapstructure:"labels"`
+		Hosts    []string          `mapstructure:"hosts" validate:"max=3"`
+		Routes   []struct {
+			Type  string `mapstructure:"type" validate:"oneof=host path" desc:"host or path"`
+			Match string `mapstructure:"match" validate:"required"`
+		} `mapstructure:"routes" validate:"dive" desc:"routes, tried in order"`
+	} `mapstructure:"app"`
+}
+
+func testSchemaDefaults() []interface{} {
+	cfg := testSchemaCfg{}
+	cfg.App.Name = "demo"
+	cfg.App.Timeout = 5 * time.Second
+	cfg.App.Hosts = []string{"localhost"}
+	return []interface{}{cfg}
+}
+
+// golden compares got with testdata/name, run go test -update to update it.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n%s", name, got)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	out, err := JSONSchema(testSchemaDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(out) {
+		t.Fatalf("invalid JSON: %s", out)
+	}
+	golden(t, "schema.golden.json", out)
+}
+
+func TestSampleYAML(t *testing.T) {
+	out, err := SampleYAML(testSchemaDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "sample.golden.yaml", out)
+}
+
+func TestRunCommand(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if ok, err := RunCommand([]string{"config", "sample"}, buf, SetDefaultConfig(testSchemaDefaults()[0])); !ok || err != nil {
+		t.Fatalf("RunCommand() = %v, %v", ok, err)
+	}
+	want, err := SampleYAML(testSchemaDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want)+"\n" {
+		t.Errorf("config sample =\n%s", got)
+	}
+	if ok, err := RunCommand([]string{"config", "unknown"}, buf); !ok || err == nil {
+		t.Errorf("RunCommand(unknown) = %v, %v", ok, err)
+	}
+	if ok, _ := RunCommand([]string{"serve"}, buf); ok {
+		t.Error("RunCommand(serve) is a config subcommand")
+	}
+}
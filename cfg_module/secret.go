@@ -0,0 +1,209 @@
+package cfg_module
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+)
+
+// RedactedValue replaces the value of sensitive keys when config is printed.
+const RedactedValue = "[REDACTED]"
+
+// SecretProvider resolves a secret reference into its value.
+// ref is the part after `<scheme>://`, e.g. `NAME` for `env://NAME`.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretProviderFunc is an adapter to use ordinary functions as SecretProvider.
+type SecretProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// fileSecret reads file:///path, trailing newlines are trimmed.
+func fileSecret(_ context.Context, ref string) (string, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// envSecret reads env://NAME.
+func envSecret(_ context.Context, ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return val, nil
+}
+
+type secretProvider struct {
+	Scheme   string
+	Provider SecretProvider
+}
+
+type secretProvidersParams struct {
+	fx.In
+
+	Providers []secretProvider `group:"secret_providers"`
+}
+
+type secretProviders struct {
+	fx.Out
+
+	Provider secretProvider `group:"secret_providers"`
+}
+
+// WithSecretProvider registers p to resolve config values like `<scheme>://ref`.
+// file:// and env:// are always available.
+func WithSecretProvider(scheme string, p SecretProvider) fx.Option {
+	return fx.Supply(secretProviders{Provider: secretProvider{Scheme: scheme, Provider: p}})
+}
+
+type secretResolver struct {
+	files     *viper.Viper
+	providers map[string]SecretProvider
+}
+
+// newSecretResolver returns a resolver of the providers, the timeout of
+// lookups is config.secret-timeout of the earlier files merged into files,
+// unless set by env or flags.
+func newSecretResolver(files *viper.Viper, extra []secretProvider) *secretResolver {
+	r := &secretResolver{
+		files: files,
+		providers: map[string]SecretProvider{
+			"file": SecretProviderFunc(fileSecret),
+			"env":  SecretProviderFunc(envSecret),
+		},
+	}
+	for _, p := range extra {
+		r.providers[p.Scheme] = p.Provider
+	}
+	return r
+}
+
+func (r *secretResolver) timeout() time.Duration {
+	const key = "config.secret-timeout"
+	// env and flags take precedence over files, and files over defaults
+	src := Source(key)
+	if !strings.HasPrefix(src, SourceEnv) && !strings.HasPrefix(src, SourceFlag) && r.files.IsSet(key) {
+		return r.files.GetDuration(key)
+	}
+	return Viper.GetDuration(key)
+}
+
+// resolve replaces every secret reference in m in place and marks the keys
+// as sensitive. prefix is the key path of m.
+func (r *secretResolver) resolve(m map[string]interface{}, prefix string) (err error) {
+	for k, v := range m {
+		key := joinKey(prefix, k)
+		switch val := v.(type) {
+		case string:
+			if m[k], err = r.resolveString(val, key); err != nil {
+				return err
+			}
+		case map[string]interface{}:
+			if err := r.resolve(val, key); err != nil {
+				return err
+			}
+		case []interface{}:
+			for i, item := range val {
+				if s, ok := item.(string); ok {
+					if val[i], err = r.resolveString(s, key); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *secretResolver) resolveString(s, key string) (string, error) {
+	scheme, ref, ok := strings.Cut(s, "://")
+	if !ok {
+		return s, nil
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		return s, nil
+	}
+	timeout := r.timeout()
+	if timeout <= 0 {
+		timeout = DefaultConfig.Config.SecretTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	val, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("key %q: failed to resolve secret %s://: %w", key, scheme, err)
+	}
+	MarkSensitive(key)
+	return val, nil
+}
+
+var sensitiveKeys sync.Map
+
+// MarkSensitive marks config keys whose values must not be printed.
+func MarkSensitive(keys ...string) {
+	for _, k := range keys {
+		sensitiveKeys.Store(strings.ToLower(k), true)
+	}
+}
+
+// IsSensitive reports whether the value of key must not be printed, that
+// is key is marked as sensitive, tagged with `sensitive:"true"` or its name
+// looks like a secret, e.g. password or webhook.
+func IsSensitive(key string) bool {
+	if _, ok := sensitiveKeys.Load(strings.ToLower(key)); ok {
+		return true
+	}
+	return sensitivePattern.MatchString(key)
+}
+
+// SensitiveKeys returns all keys marked as sensitive, sorted.
+func SensitiveKeys() []string {
+	keys := []string{}
+	sensitiveKeys.Range(func(k, _ interface{}) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// Redacted returns all settings of v with the values of sensitive keys
+// replaced by RedactedValue. Use it whenever config is printed.
+func Redacted(v *viper.Viper) map[string]interface{} {
+	settings := v.AllSettings()
+	for _, key := range v.AllKeys() {
+		if IsSensitive(key) {
+			redactKey(settings, strings.Split(key, "."))
+		}
+	}
+	return settings
+}
+
+func redactKey(m map[string]interface{}, path []string) {
+	v, ok := m[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		m[path[0]] = RedactedValue
+		return
+	}
+	if sub, ok := v.(map[string]interface{}); ok {
+		redactKey(sub, path[1:])
+	}
+}
@@ -0,0 +1,77 @@
+package cfg_module
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/fx"
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// GCPSecretScheme is the scheme of Secret Manager references, e.g.
+// gcpsm://projects/my-project/secrets/slack-webhook/versions/latest.
+// The version defaults to latest when omitted.
+const GCPSecretScheme = "gcpsm"
+
+// GCPSecretProvider resolves secrets from GCP Secret Manager.
+// The client is created on first use, so credentials are only required
+// when the config actually references a secret. Creating it is retried by
+// the next lookup on error.
+type GCPSecretProvider struct {
+	opts []option.ClientOption
+
+	mu  sync.Mutex
+	svc *secretmanager.Service
+}
+
+func NewGCPSecretProvider(opts ...option.ClientOption) *GCPSecretProvider {
+	return &GCPSecretProvider{opts: opts}
+}
+
+// WithGCPSecretManager registers a GCPSecretProvider for gcpsm:// references.
+func WithGCPSecretManager(opts ...option.ClientOption) fx.Option {
+	return WithSecretProvider(GCPSecretScheme, NewGCPSecretProvider(opts...))
+}
+
+// service returns the client, it is created with context.Background since
+// it outlives the lookup creating it.
+func (p *GCPSecretProvider) service() (*secretmanager.Service, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.svc != nil {
+		return p.svc, nil
+	}
+	svc, err := secretmanager.NewService(context.Background(), p.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create secret manager client: %w", err)
+	}
+	p.svc = svc
+	return svc, nil
+}
+
+func (p *GCPSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	svc, err := p.service()
+	if err != nil {
+		return "", err
+	}
+	name := strings.Trim(ref, "/")
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	resp, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if resp.Payload == nil {
+		return "", fmt.Errorf("secret %s has no payload", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode secret %s: %w", name, err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,122 @@
+package cfg_module
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/option"
+)
+
+// fakeSecretManager serves the Secret Manager access API from secrets,
+// keyed by secret version name.
+func fakeSecretManager(t *testing.T, secrets map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GET /v1/projects/p/secrets/s/versions/v:access
+		name := r.URL.Path[len("/v1/") : len(r.URL.Path)-len(":access")]
+		val, ok := secrets[name]
+		if !ok {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":    name,
+			"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(val))},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := writeFile(t, dir, "token", "file-secret\n")
+	path := writeFile(t, dir, "base.yaml", `
+log:
+  level: info
+  slack-webhook: gcpsm://projects/p/secrets/webhook
+db:
+  password: env://DB_PASSWORD
+  token: file://`+secretFile+`
+`)
+	t.Setenv("DB_PASSWORD", "env-secret")
+	srv := fakeSecretManager(t, map[string]string{
+		"projects/p/secrets/webhook/versions/latest": "https://hooks.slack.com/x",
+	})
+
+	v := viper.New()
+	resolver := newSecretResolver(v, []secretProvider{{
+		Scheme:   GCPSecretScheme,
+		Provider: NewGCPSecretProvider(option.WithEndpoint(srv.URL), option.WithoutAuthentication()),
+	}})
+	if err := mergeConfigFile(v, path, resolver); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"log.slack-webhook": "https://hooks.slack.com/x",
+		"db.password":       "env-secret",
+		"db.token":          "file-secret",
+	}
+	for key, val := range want {
+		if got := v.GetString(key); got != val {
+			t.Errorf("%s = %q, want %q", key, got, val)
+		}
+		if !IsSensitive(key) {
+			t.Errorf("%s is not marked as sensitive", key)
+		}
+	}
+	if IsSensitive("log.level") {
+		t.Error("log.level should not be sensitive")
+	}
+
+	redacted := Redacted(v)
+	if got := redacted["db"].(map[string]interface{})["password"]; got != RedactedValue {
+		t.Errorf("redacted db.password = %v", got)
+	}
+	if got := redacted["log"].(map[string]interface{})["level"]; got != "info" {
+		t.Errorf("redacted log.level = %v", got)
+	}
+}
+
+func TestSecretTimeout(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "base.yaml", "vault:\n  api-key: slow://key\n")
+	v := viper.New()
+	v.Set("config.secret-timeout", "10ms")
+	resolver := newSecretResolver(v, []secretProvider{{
+		Scheme: "slow",
+		Provider: SecretProviderFunc(func(ctx context.Context, _ string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}),
+	}})
+	if err := mergeConfigFile(v, path, resolver); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("mergeConfigFile() = %v, want deadline exceeded", err)
+	}
+}
+
+func TestGCPSecretProviderRetry(t *testing.T) {
+	srv := fakeSecretManager(t, map[string]string{"projects/p/secrets/s/versions/latest": "ok"})
+	p := NewGCPSecretProvider(option.WithCredentialsFile(filepath.Join(t.TempDir(), "missing.json")))
+	if _, err := p.Resolve(context.Background(), "projects/p/secrets/s"); err == nil {
+		t.Fatal("Resolve() without credentials succeeded")
+	}
+	// the client is not cached on error
+	p.opts = []option.ClientOption{option.WithEndpoint(srv.URL), option.WithoutAuthentication()}
+	ctx, cancel := context.WithCancel(context.Background())
+	if got, err := p.Resolve(ctx, "projects/p/secrets/s"); err != nil || got != "ok" {
+		t.Fatalf("Resolve() = %q, %v", got, err)
+	}
+	// nor bound to the context of the first lookup
+	cancel()
+	if got, err := p.Resolve(context.Background(), "projects/p/secrets/s"); err != nil || got != "ok" {
+		t.Errorf("Resolve() after the first context is canceled = %q, %v", got, err)
+	}
+}
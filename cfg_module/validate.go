@@ -0,0 +1,212 @@
+package cfg_module
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"pkg.lucas.icu/micro/viperutil"
+)
+
+const (
+	UnknownKeysError  = "error"
+	UnknownKeysWarn   = "warn"
+	UnknownKeysIgnore = "ignore"
+)
+
+type Config struct {
+	// UnknownKeys decides what happens to keys in the config files that no
+	// registered config consumes: error, warn or ignore.
+	UnknownKeys string `mapstructure:"unknown-keys" validate:"oneof=error warn ignore"`
+	// SecretTimeout bounds every secret lookup, it is read from the config
+	// loaded before the lookup, i.e. defaults, env and earlier files.
+	SecretTimeout time.Duration `mapstructure:"secret-timeout" validate:"gt=0" desc:"timeout of each secret lookup, set in defaults, env or an earlier config file"`
+}
+
+var DefaultConfig = wrappedCfg{
+	Config: Config{
+		UnknownKeys:   UnknownKeysWarn,
+		SecretTimeout: 10 * time.Second,
+	},
+}
+
+type wrappedCfg struct {
+	Config Config `mapstructure:"config"`
+}
+
+func readConfig(v *viper.Viper) (Config, error) {
+	cfg := &wrappedCfg{}
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg.Config, nil
+}
+
+// Validate unmarshals every registered default config from v and validates
+// it, all failures are reported at once with their full key paths.
+// Unknown keys in the config files are reported as well when
+// config.unknown-keys is error.
+func Validate(v *viper.Viper, defaults []interface{}) error {
+	var errs []error
+	validate := newValidator()
+	for _, d := range defaults {
+		typ := reflect.TypeOf(d)
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		cfg := reflect.New(typ)
+		if err := viperutil.Unmarshal(v, cfg.Interface()); err != nil {
+			errs = append(errs, fmt.Errorf("unable to decode config into %s: %w", typ, err))
+			continue
+		}
+		if err := validate.Struct(cfg.Interface()); err != nil {
+			errs = append(errs, fieldErrors(err)...)
+		}
+	}
+
+	cfg, err := readConfig(v)
+	if err != nil {
+		errs = append(errs, err)
+	} else if cfg.UnknownKeys == UnknownKeysError {
+		for _, key := range unknownKeys(v, defaults) {
+			errs = append(errs, fmt.Errorf("config key %q: unknown key", key))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// newValidator reports field names by their mapstructure keys.
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return validate
+}
+
+func fieldErrors(err error) []error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []error{err}
+	}
+	errs := make([]error, 0, len(verrs))
+	for _, fe := range verrs {
+		// strip the name of the root struct
+		_, key, _ := strings.Cut(fe.Namespace(), ".")
+		rule := fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+		errs = append(errs, fmt.Errorf("config key %q: failed on the %q rule", strings.ToLower(key), rule))
+	}
+	return errs
+}
+
+// unknownKeys returns the sorted keys in the config files which are not
+// consumed by any of the defaults.
+func unknownKeys(v *viper.Viper, defaults []interface{}) []string {
+	known := map[string]bool{}
+	open := map[string]bool{}
+	for _, d := range defaults {
+		collectKeys(reflect.TypeOf(d), "", known, open)
+	}
+
+	unknown := []string{}
+	for _, key := range v.AllKeys() {
+		if !v.InConfig(key) || known[key] || underOpenKey(key, open) {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// collectKeys records every key path of typ into known, maps and interfaces
+// accept any sub key so their paths are recorded into open as well.
+func collectKeys(typ reflect.Type, prefix string, known, open map[string]bool) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if prefix != "" {
+		known[prefix] = true
+	}
+	if viperutil.IsTextType(typ) {
+		return
+	}
+	switch typ.Kind() {
+	case reflect.Map, reflect.Interface:
+		open[prefix] = true
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if name == "-" {
+				continue
+			}
+			if strings.Contains(opts, "squash") {
+				collectKeys(field.Type, prefix, known, open)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			collectKeys(field.Type, joinKey(prefix, strings.ToLower(name)), known, open)
+		}
+	}
+}
+
+func underOpenKey(key string, open map[string]bool) bool {
+	for prefix := range open {
+		if prefix == "" || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+type warnUnknownKeysParams struct {
+	fx.In
+
+	Viper    *viper.Viper
+	Defaults []interface{} `group:"default_configs"`
+	Logger   *zap.Logger   `optional:"true"`
+}
+
+// WarnUnknownKeys logs the unknown keys in the config files when
+// config.unknown-keys is warn.
+func WarnUnknownKeys(p warnUnknownKeysParams) error {
+	cfg, err := readConfig(p.Viper)
+	if err != nil {
+		return err
+	}
+	if cfg.UnknownKeys != UnknownKeysWarn {
+		return nil
+	}
+	for _, key := range unknownKeys(p.Viper, p.Defaults) {
+		if p.Logger != nil {
+			p.Logger.Warn("unknown config key", zap.String("key", key))
+		} else {
+			fmt.Fprintf(os.Stderr, "WARN\tunknown config key %q\n", key)
+		}
+	}
+	return nil
+}
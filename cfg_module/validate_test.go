@@ -0,0 +1,51 @@
+package cfg_module
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+type testServerCfg struct {
+	Server struct {
+		Port    int               `mapstructure:"port" validate:"gt=0"`
+		Addr    string            `mapstructure:"addr" validate:"required,ip"`
+		Headers map[string]string `mapstructure:"headers"`
+	} `mapstructure:"server"`
+}
+
+func TestValidate(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(`
+config:
+  unknown-keys: error
+server:
+  port: -1
+  addr: localhost
+  prot: 3000
+  headers:
+    x-anything: ok
+`)); err != nil {
+		t.Fatal(err)
+	}
+	defaults := []interface{}{DefaultConfig, testServerCfg{}}
+
+	err := Validate(v, defaults)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		`config key "server.port": failed on the "gt=0" rule`,
+		`config key "server.addr": failed on the "ip" rule`,
+		`config key "server.prot": unknown key`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "x-anything") {
+		t.Errorf("keys of a map should be accepted: %v", err)
+	}
+}
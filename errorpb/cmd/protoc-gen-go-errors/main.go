@@ -0,0 +1,221 @@
+// protoc-gen-go-errors generates typed constructors and catalog registrations
+// for enums whose values carry the (errorpb.error) option.
+//
+//	enum ErrorReason {
+//	  option (errorpb.domain) = "user";
+//	  ERROR_REASON_UNSPECIFIED = 0;
+//	  USER_NOT_FOUND = 1 [(errorpb.error) = {code: NOT_FOUND, message: "user %s not found"}];
+//	}
+//
+// generates
+//
+//	var ErrUserNotFound = errorpb.Register(&errorpb.Definition{...})
+//	func ErrorUserNotFound(arg1 interface{}) *errorpb.Error
+//	func IsUserNotFound(err error) bool
+//
+// The constructor takes an argument per verb of the message, so that the
+// message is always formatted. Codes must be grpc error codes, and messages
+// with indexed arguments or * are rejected.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+const (
+	codesPackage   = protogen.GoImportPath("google.golang.org/grpc/codes")
+	errorpbPackage = protogen.GoImportPath("pkg.lucas.icu/micro/errorpb")
+)
+
+func main() {
+	protogen.Options{ParamFunc: flag.CommandLine.Set}.Run(generate)
+}
+
+func generate(gen *protogen.Plugin) error {
+	gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+	// IDs are unique across all files of a run, errorpb.CheckRegistry
+	// reports the rest at startup
+	ids := map[string]string{}
+	for _, f := range gen.Files {
+		if !f.Generate {
+			continue
+		}
+		if err := generateFile(gen, f, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type errorDef struct {
+	value  *protogen.EnumValue
+	goName string
+	domain string
+	opts   *errorpb.ErrorOptions
+	args   int // arguments of the message
+}
+
+func generateFile(gen *protogen.Plugin, f *protogen.File, ids map[string]string) error {
+	var defs []errorDef
+	for _, enum := range allEnums(f) {
+		domain := proto.GetExtension(enum.Desc.Options(), errorpb.E_Domain).(string)
+		for _, v := range enum.Values {
+			opts, ok := v.Desc.Options().(*descriptorpb.EnumValueOptions)
+			if !ok || !proto.HasExtension(opts, errorpb.E_Error) {
+				continue
+			}
+			id := string(v.Desc.Name())
+			if other, ok := ids[id]; ok {
+				return fmt.Errorf("%s: error ID %s is already defined in %s", f.Desc.Path(), id, other)
+			}
+			ids[id] = f.Desc.Path()
+			errOpts := proto.GetExtension(opts, errorpb.E_Error).(*errorpb.ErrorOptions)
+			if errOpts.Code <= errorpb.Code_OK || errOpts.Code > errorpb.Code_UNAUTHENTICATED {
+				return fmt.Errorf("%s: code %d of error ID %s is not a grpc error code", f.Desc.Path(), errOpts.Code, id)
+			}
+			args, err := messageArgs(errOpts.Message)
+			if err != nil {
+				return fmt.Errorf("%s: invalid message of error ID %s: %w", f.Desc.Path(), id, err)
+			}
+			defs = append(defs, errorDef{
+				value:  v,
+				goName: goName(string(enum.Desc.Name()), id),
+				domain: domain,
+				opts:   errOpts,
+				args:   args,
+			})
+		}
+	}
+	if len(defs) == 0 {
+		return nil
+	}
+
+	g := gen.NewGeneratedFile(f.GeneratedFilenamePrefix+"_errors.pb.go", f.GoImportPath)
+	g.P("// Code generated by protoc-gen-go-errors. DO NOT EDIT.")
+	g.P("// source: ", f.Desc.Path())
+	g.P()
+	g.P("package ", f.GoPackageName)
+	g.P()
+	for _, d := range defs {
+		register := g.QualifiedGoIdent(errorpbPackage.Ident("Register"))
+		definition := g.QualifiedGoIdent(errorpbPackage.Ident("Definition"))
+		code := g.QualifiedGoIdent(codesPackage.Ident(codeName(d.opts.Code)))
+		g.P(d.value.Comments.Leading, "var Err", d.goName, " = ", register, "(&", definition, "{")
+		g.P("ID: ", fmt.Sprintf("%q", d.value.Desc.Name()), ",")
+		if d.domain != "" {
+			g.P("Domain: ", fmt.Sprintf("%q", d.domain), ",")
+		}
+		g.P("Code: ", code, ",")
+		if d.opts.Message != "" {
+			g.P("Message: ", fmt.Sprintf("%q", d.opts.Message), ",")
+		}
+		if d.opts.HttpStatus != 0 {
+			g.P("HTTPStatus: ", d.opts.HttpStatus, ",")
+		}
+		g.P("Source: ", fmt.Sprintf("%q", f.Desc.Path()), ",")
+		g.P("})")
+		g.P()
+		args := make([]string, d.args)
+		for i := range args {
+			args[i] = fmt.Sprintf("arg%d", i+1)
+		}
+		if d.args > 0 {
+			g.P("// Error", d.goName, " creates a ", d.value.Desc.Name(), " error, args format the default message.")
+			g.P("func Error", d.goName, "(", strings.Join(args, ", "), " interface{}) *", g.QualifiedGoIdent(errorpbPackage.Ident("Error")), " {")
+		} else {
+			g.P("// Error", d.goName, " creates a ", d.value.Desc.Name(), " error.")
+			g.P("func Error", d.goName, "() *", g.QualifiedGoIdent(errorpbPackage.Ident("Error")), " {")
+		}
+		g.P("return Err", d.goName, ".New(", strings.Join(args, ", "), ")")
+		g.P("}")
+		g.P()
+		g.P("// Is", d.goName, " reports whether err is a ", d.value.Desc.Name(), " error.")
+		g.P("func Is", d.goName, "(err error) bool {")
+		g.P("return Err", d.goName, ".Is(err)")
+		g.P("}")
+		g.P()
+	}
+	return nil
+}
+
+func allEnums(f *protogen.File) []*protogen.Enum {
+	enums := append([]*protogen.Enum{}, f.Enums...)
+	var walk func(msgs []*protogen.Message)
+	walk = func(msgs []*protogen.Message) {
+		for _, m := range msgs {
+			enums = append(enums, m.Enums...)
+			walk(m.Messages)
+		}
+	}
+	walk(f.Messages)
+	return enums
+}
+
+// goName converts USER_NOT_FOUND into UserNotFound, the prefix of the enum
+// name (ERROR_REASON_ of ErrorReason) is trimmed.
+func goName(enum, value string) string {
+	prefix := ""
+	for i, r := range enum {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			prefix += "_"
+		}
+		prefix += strings.ToUpper(string(r))
+	}
+	value = strings.TrimPrefix(value, prefix+"_")
+	name := ""
+	for _, part := range strings.Split(strings.ToLower(value), "_") {
+		if part != "" {
+			name += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return name
+}
+
+// codeName returns the name of the codes.Code constant of c, a valid code.
+func codeName(c errorpb.Code) string {
+	return codes.Code(c).String()
+}
+
+// messageArgs returns the number of arguments of the fmt template msg.
+// Indexed arguments and * are not supported, and %% is rejected without
+// arguments, since the message is not formatted then.
+func messageArgs(msg string) (int, error) {
+	n, escaped := 0, false
+	for i := 0; i < len(msg); i++ {
+		if msg[i] != '%' {
+			continue
+		}
+		// flags, width and precision
+		i++
+		for i < len(msg) && strings.IndexByte("+-# 0123456789.", msg[i]) >= 0 {
+			i++
+		}
+		if i == len(msg) {
+			return 0, errors.New("missing verb at the end")
+		}
+		switch c := msg[i]; {
+		case c == '%':
+			escaped = true
+		case c == '[' || c == '*':
+			return 0, errors.New("indexed arguments and * are not supported")
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			n++
+		default:
+			return 0, fmt.Errorf("invalid verb %%%c", c)
+		}
+	}
+	if n == 0 && escaped {
+		return 0, errors.New("%% without arguments, use %")
+	}
+	return n, nil
+}
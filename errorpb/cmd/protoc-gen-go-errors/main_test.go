@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"pkg.lucas.icu/micro/errorpb"
+	example "pkg.lucas.icu/micro/example/proto"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// withImports returns f after its imports, recursively.
+func withImports(f protoreflect.FileDescriptor, seen map[string]bool) []*descriptorpb.FileDescriptorProto {
+	if seen[f.Path()] {
+		return nil
+	}
+	seen[f.Path()] = true
+	var files []*descriptorpb.FileDescriptorProto
+	for i := 0; i < f.Imports().Len(); i++ {
+		files = append(files, withImports(f.Imports().Get(i).FileDescriptor, seen)...)
+	}
+	return append(files, protodesc.ToFileDescriptorProto(f))
+}
+
+// run runs the plugin on files, which import errorpb.proto.
+func run(files ...*descriptorpb.FileDescriptorProto) (*pluginpb.CodeGeneratorResponse, error) {
+	req := &pluginpb.CodeGeneratorRequest{
+		Parameter: proto.String("paths=source_relative"),
+		ProtoFile: withImports(errorpb.File_errorpb_proto, map[string]bool{}),
+	}
+	for _, f := range files {
+		req.FileToGenerate = append(req.FileToGenerate, f.GetName())
+		req.ProtoFile = append(req.ProtoFile, f)
+	}
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := generate(gen); err != nil {
+		return nil, err
+	}
+	return gen.Response(), nil
+}
+
+func TestExample(t *testing.T) {
+	resp, err := run(protodesc.ToFileDescriptorProto(example.File_errors_proto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.File) != 1 || resp.File[0].GetName() != "errors_errors.pb.go" {
+		t.Fatalf("generated %v", resp.File)
+	}
+	// the descriptors compiled into Go have no comments
+	got := []byte(resp.File[0].GetContent())
+	path := filepath.Join("testdata", "errors_errors.pb.go.golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("errors_errors.pb.go differs:\n%s", got)
+	}
+}
+
+// errorsFile returns a file defining an error per option.
+func errorsFile(name string, opts ...*errorpb.ErrorOptions) *descriptorpb.FileDescriptorProto {
+	enum := &descriptorpb.EnumDescriptorProto{
+		Name:  proto.String("ErrorReason"),
+		Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("ERROR_REASON_UNSPECIFIED"), Number: proto.Int32(0)}},
+	}
+	for i, opt := range opts {
+		vopts := &descriptorpb.EnumValueOptions{}
+		proto.SetExtension(vopts, errorpb.E_Error, opt)
+		enum.Value = append(enum.Value, &descriptorpb.EnumValueDescriptorProto{
+			Name:    proto.String("ERROR_" + string(rune('A'+i))),
+			Number:  proto.Int32(int32(i + 1)),
+			Options: vopts,
+		})
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(name),
+		Package:    proto.String(strings.TrimSuffix(name, ".proto")),
+		Dependency: []string{"errorpb.proto"},
+		Syntax:     proto.String("proto3"),
+		Options:    &descriptorpb.FileOptions{GoPackage: proto.String("example.com/test")},
+		EnumType:   []*descriptorpb.EnumDescriptorProto{enum},
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, c := range []struct {
+		files []*descriptorpb.FileDescriptorProto
+		want  string
+	}{
+		{[]*descriptorpb.FileDescriptorProto{errorsFile("a.proto", &errorpb.ErrorOptions{Code: 17})}, "code 17 of error ID ERROR_A is not a grpc error code"},
+		{[]*descriptorpb.FileDescriptorProto{errorsFile("a.proto", &errorpb.ErrorOptions{})}, "code 0 of error ID ERROR_A"},
+		{[]*descriptorpb.FileDescriptorProto{errorsFile("a.proto", &errorpb.ErrorOptions{Code: errorpb.Code_INTERNAL, Message: "%[1]s"})}, "indexed arguments"},
+		{[]*descriptorpb.FileDescriptorProto{errorsFile("a.proto", &errorpb.ErrorOptions{Code: errorpb.Code_INTERNAL, Message: "100%%"})}, "%% without arguments"},
+		{[]*descriptorpb.FileDescriptorProto{errorsFile("a.proto", &errorpb.ErrorOptions{Code: errorpb.Code_INTERNAL, Message: "50%"})}, "missing verb"},
+		{[]*descriptorpb.FileDescriptorProto{
+			errorsFile("a.proto", &errorpb.ErrorOptions{Code: errorpb.Code_INTERNAL}),
+			errorsFile("b.proto", &errorpb.ErrorOptions{Code: errorpb.Code_INTERNAL}),
+		}, "b.proto: error ID ERROR_A is already defined in a.proto"},
+	} {
+		if _, err := run(c.files...); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.files[0].GetName(), err, c.want)
+		}
+	}
+}
+
+func TestMessageArgs(t *testing.T) {
+	for msg, want := range map[string]int{
+		"":                  0,
+		"not found":         0,
+		"%s not found":      1,
+		"%-5d of %.2f%%":    2,
+		"%q is %v, %+v %#x": 4,
+	} {
+		if got, err := messageArgs(msg); err != nil || got != want {
+			t.Errorf("messageArgs(%q) = %d, %v, want %d", msg, got, err, want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"go.uber.org/zap/zapcore"
@@ -14,6 +15,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"pkg.lucas.icu/micro/gateway_middleware"
 	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
 )
@@ -80,6 +83,71 @@ func (e *Error) WithDomain(domain string) *Error {
 	return e
 }
 
+// WithFieldViolation adds a field of the request that failed validation,
+// field is the path to the field, e.g. `user.emails[0]`.
+func (e *Error) WithFieldViolation(field, rule, description string) *Error {
+	e.FieldViolations = append(e.FieldViolations, &FieldViolation{
+		Field:       field,
+		Rule:        rule,
+		Description: description,
+	})
+	return e
+}
+
+// WithRetryDelay tells clients how long to wait before retrying.
+func (e *Error) WithRetryDelay(d time.Duration) *Error {
+	e.RetryDelay = durationpb.New(d)
+	return e
+}
+
+// WithQuotaViolation adds a quota check that failed, subject is e.g. `project:123`.
+func (e *Error) WithQuotaViolation(subject, description string) *Error {
+	e.QuotaViolations = append(e.QuotaViolations, &QuotaViolation{
+		Subject:     subject,
+		Description: description,
+	})
+	return e
+}
+
+// WithPreconditionViolation adds a precondition that failed, typ is e.g. `TOS`.
+func (e *Error) WithPreconditionViolation(typ, subject, description string) *Error {
+	e.PreconditionViolations = append(e.PreconditionViolations, &PreconditionViolation{
+		Type:        typ,
+		Subject:     subject,
+		Description: description,
+	})
+	return e
+}
+
+// WithResourceInfo describes the resource that is being accessed.
+func (e *Error) WithResourceInfo(resourceType, resourceName, owner, description string) *Error {
+	e.ResourceInfo = &ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Owner:        owner,
+		Description:  description,
+	}
+	return e
+}
+
+// WithHelpLink adds a link to documentation for the error.
+func (e *Error) WithHelpLink(description, url string) *Error {
+	e.HelpLinks = append(e.HelpLinks, &HelpLink{
+		Description: description,
+		Url:         url,
+	})
+	return e
+}
+
+// WithLocalizedMessage sets a message that is safe to show to end users.
+func (e *Error) WithLocalizedMessage(locale, msg string) *Error {
+	e.LocalizedMessage = &LocalizedMessage{
+		Locale:  locale,
+		Message: msg,
+	}
+	return e
+}
+
 // WithContext will add request id to the meta
 func (e *Error) WithContext(ctx context.Context) *Error {
 	if reqID := request_id.ExtractRequestID(ctx); reqID != "" {
@@ -93,17 +161,83 @@ func (e *Error) GRPCStatus() *status.Status {
 		return status.New(codes.OK, "OK")
 	}
 	st := status.New(codes.Code(e.Code), e.Message)
-	nst, err := st.WithDetails(
+	nst, err := st.WithDetails(e.details()...)
+	if err == nil {
+		return nst
+	}
+	return st
+}
+
+// details converts e into the standard error details of google.rpc.
+func (e *Error) details() []protoiface.MessageV1 {
+	details := []protoiface.MessageV1{
 		&errdetails.ErrorInfo{
 			Reason:   e.Id,
 			Domain:   e.Domain,
 			Metadata: e.Metadata,
 		},
-	)
-	if err == nil {
-		return nst
 	}
-	return st
+	if len(e.FieldViolations) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, v := range e.FieldViolations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		// the standard details lack the rules, so the Error itself is
+		// attached as well and preferred by fromStatus
+		details = append(details, br, e)
+	}
+	if e.RetryDelay != nil {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: e.RetryDelay})
+	}
+	if len(e.QuotaViolations) > 0 {
+		qf := &errdetails.QuotaFailure{}
+		for _, v := range e.QuotaViolations {
+			qf.Violations = append(qf.Violations, &errdetails.QuotaFailure_Violation{
+				Subject:     v.Subject,
+				Description: v.Description,
+			})
+		}
+		details = append(details, qf)
+	}
+	if len(e.PreconditionViolations) > 0 {
+		pf := &errdetails.PreconditionFailure{}
+		for _, v := range e.PreconditionViolations {
+			pf.Violations = append(pf.Violations, &errdetails.PreconditionFailure_Violation{
+				Type:        v.Type,
+				Subject:     v.Subject,
+				Description: v.Description,
+			})
+		}
+		details = append(details, pf)
+	}
+	if ri := e.ResourceInfo; ri != nil {
+		details = append(details, &errdetails.ResourceInfo{
+			ResourceType: ri.ResourceType,
+			ResourceName: ri.ResourceName,
+			Owner:        ri.Owner,
+			Description:  ri.Description,
+		})
+	}
+	if len(e.HelpLinks) > 0 {
+		help := &errdetails.Help{}
+		for _, l := range e.HelpLinks {
+			help.Links = append(help.Links, &errdetails.Help_Link{
+				Description: l.Description,
+				Url:         l.Url,
+			})
+		}
+		details = append(details, help)
+	}
+	if lm := e.LocalizedMessage; lm != nil {
+		details = append(details, &errdetails.LocalizedMessage{
+			Locale:  lm.Locale,
+			Message: lm.Message,
+		})
+	}
+	return details
 }
 
 // MarshalLogObject implements zap.ObjectMarshaler
@@ -118,6 +252,21 @@ func (e *Error) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	if len(e.Metadata) != 0 {
 		enc.AddObject("metadata", mapMarshaler(e.Metadata))
 	}
+	if len(e.FieldViolations) != 0 {
+		enc.AddArray("field_violations", fieldViolations(e.FieldViolations))
+	}
+	if e.RetryDelay != nil {
+		enc.AddDuration("retry_delay", e.RetryDelay.AsDuration())
+	}
+	return nil
+}
+
+type fieldViolations []*FieldViolation
+
+func (vs fieldViolations) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, v := range vs {
+		enc.AppendString(fmt.Sprintf("%s(%s): %s", v.Field, v.Rule, v.Description))
+	}
 	return nil
 }
 
@@ -139,10 +288,37 @@ func fromStatus(st *status.Status) *Error {
 		Message: st.Message(),
 	}
 	for _, d := range st.Details() {
-		if ei, ok := d.(*errdetails.ErrorInfo); ok {
-			e.Id = ei.Reason
-			e.Domain = ei.Domain
-			e.Metadata = ei.Metadata
+		switch d := d.(type) {
+		case *Error:
+			own := proto.Clone(d).(*Error)
+			own.Code, own.Message = e.Code, e.Message
+			return own
+		case *errdetails.ErrorInfo:
+			e.Id = d.Reason
+			e.Domain = d.Domain
+			e.Metadata = d.Metadata
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				e.WithFieldViolation(v.Field, "", v.Description)
+			}
+		case *errdetails.RetryInfo:
+			e.RetryDelay = d.RetryDelay
+		case *errdetails.QuotaFailure:
+			for _, v := range d.Violations {
+				e.WithQuotaViolation(v.Subject, v.Description)
+			}
+		case *errdetails.PreconditionFailure:
+			for _, v := range d.Violations {
+				e.WithPreconditionViolation(v.Type, v.Subject, v.Description)
+			}
+		case *errdetails.ResourceInfo:
+			e.WithResourceInfo(d.ResourceType, d.ResourceName, d.Owner, d.Description)
+		case *errdetails.Help:
+			for _, l := range d.Links {
+				e.WithHelpLink(l.Description, l.Url)
+			}
+		case *errdetails.LocalizedMessage:
+			e.WithLocalizedMessage(d.Locale, d.Message)
 		}
 	}
 	return e
@@ -158,7 +334,9 @@ func FromError(err error) (*Error, bool) {
 		return nil, false
 	}
 
-	if e, ok := err.(*Error); ok {
+	// also finds the Error wrapped by fmt.Errorf("%w") or Wrap
+	var e *Error
+	if errors.As(err, &e) {
 		return e, true
 	}
 
@@ -191,36 +369,150 @@ func fromCommonError(err error) (*Error, bool) {
 	return New(codes.Unknown).WithMessage(err.Error()), false
 }
 
-func GrpcGWErrorHandler() runtime.ServeMuxOption {
-	return runtime.WithErrorHandler(gateway_middleware.NewHTTPErrorHandler(
-		func(err error) (codes.Code, proto.Message) {
-			pb := MustFromError(err)
-			return codes.Code(pb.Code), pb
-		},
-	))
+type gwOptions struct {
+	redactor *Redactor
+	format   string
+	typeBase string
+}
+
+// GWOption configures the gateway error handlers.
+type GWOption func(o *gwOptions)
+
+// WithRedactor redacts errors with r before they are rendered, the full
+// errors are recorded on the span.
+func WithRedactor(r *Redactor) GWOption {
+	return func(o *gwOptions) {
+		o.redactor = r
+	}
+}
+
+// WithErrorFormat renders errors in format, one of gateway_middleware.ErrorFormatProto,
+// ErrorFormatProblem and ErrorFormatNegotiate, see (*Error).Problem for typeBase.
+func WithErrorFormat(format, typeBase string) GWOption {
+	return func(o *gwOptions) {
+		o.format = format
+		o.typeBase = typeBase
+	}
+}
+
+func newGWOptions(opts []GWOption) *gwOptions {
+	o := &gwOptions{format: gateway_middleware.ErrorFormatProto}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *gwOptions) handlerOptions() gateway_middleware.HandlerOption {
+	return gateway_middleware.WithProblem(o.format, func(r *http.Request, status int, err error) *gateway_middleware.Problem {
+		return MustFromError(err).Problem(r, status, o.typeBase)
+	})
+}
+
+func gwErrorParser(err error) (codes.Code, proto.Message) {
+	pb := MustFromError(err)
+	return codes.Code(pb.Code), pb
+}
+
+// prepare redacts err and applies the HTTP status override of registered
+// errors, unless err is already a *runtime.HTTPStatusError.
+func (o *gwOptions) prepare(r *http.Request, err error) error {
+	st := 0
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		st, err = customStatus.HTTPStatus, customStatus.Err
+	}
+	ctx := r.Context()
+	if out := o.redactor.RedactError(ctx, err); out != err {
+		RecordError(ctx, err)
+		err = out
+	}
+	if st == 0 {
+		st = httpStatus(MustFromError(err).Id)
+	}
+	if st != 0 {
+		err = &runtime.HTTPStatusError{HTTPStatus: st, Err: err}
+	}
+	return err
+}
+
+func GrpcGWErrorHandler(opts ...GWOption) runtime.ServeMuxOption {
+	return runtime.WithErrorHandler(NewHTTPErrorHandler(opts...))
+}
+
+// NewHTTPErrorHandler returns the error handler of GrpcGWErrorHandler, it
+// can also render errors outside of the gateway, mux may be nil then.
+func NewHTTPErrorHandler(opts ...GWOption) runtime.ErrorHandlerFunc {
+	o := newGWOptions(opts)
+	handler := gateway_middleware.NewHTTPErrorHandler(gwErrorParser, o.handlerOptions())
+	return func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+		handler(ctx, mux, marshaler, w, r, o.prepare(r, err))
+	}
 }
 
-func GrpcGWRoutingErrorHandler() runtime.ServeMuxOption {
+// GrpcGWRoutingErrorHandler renders routing errors like GrpcGWErrorHandler,
+// WithRedactor is ignored since routing errors are not sensitive.
+func GrpcGWRoutingErrorHandler(opts ...GWOption) runtime.ServeMuxOption {
+	o := newGWOptions(opts)
 	return runtime.WithRoutingErrorHandler(gateway_middleware.NewRoutingErrorHandler(
-		func(httpStatus int) error {
-			err := New(codes.Internal).WithMessage("Unexpected routing error")
-			switch httpStatus {
-			case http.StatusBadRequest:
-				err.WithCode(codes.InvalidArgument).WithID(codes.InvalidArgument.String()).WithMessage(http.StatusText(httpStatus))
-			case http.StatusMethodNotAllowed:
-				err.WithCode(codes.Unimplemented).WithID(codes.Unimplemented.String()).WithMessage(http.StatusText(httpStatus))
-			case http.StatusNotFound:
-				err.WithCode(codes.NotFound).WithID(codes.NotFound.String()).WithMessage(http.StatusText(httpStatus))
-			}
-			return err
-		},
-		func(err error) (codes.Code, proto.Message) {
-			pb := MustFromError(err)
-			return codes.Code(pb.Code), pb
-		},
+		routingError,
+		gwErrorParser,
+		o.handlerOptions(),
 	))
 }
 
+func routingError(httpStatus int) error {
+	err := New(codes.Internal).WithMessage("Unexpected routing error")
+	switch httpStatus {
+	case http.StatusBadRequest:
+		err.WithCode(codes.InvalidArgument).WithID(codes.InvalidArgument.String()).WithMessage(http.StatusText(httpStatus))
+	case http.StatusMethodNotAllowed:
+		err.WithCode(codes.Unimplemented).WithID(codes.Unimplemented.String()).WithMessage(http.StatusText(httpStatus))
+	case http.StatusNotFound:
+		err.WithCode(codes.NotFound).WithID(codes.NotFound.String()).WithMessage(http.StatusText(httpStatus))
+	}
+	return err
+}
+
+// CodeFromHTTPStatus is the reverse of runtime.HTTPStatusFromCode, unknown
+// 4xx statuses are FailedPrecondition and 5xx are Internal.
+func CodeFromHTTPStatus(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499: // client closed request
+		return codes.Canceled
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	switch {
+	case httpStatus < 400:
+		return codes.OK
+	case httpStatus < 500:
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
 func ErrorParser(err error) (zapcore.ObjectMarshaler, bool) {
+	// keep the cause in logs
+	var w *wrapError
+	if errors.As(err, &w) {
+		return w, true
+	}
 	return MustFromError(err), true
 }
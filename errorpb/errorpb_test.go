@@ -0,0 +1,161 @@
+package errorpb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"pkg.lucas.icu/micro/gateway_middleware"
+)
+
+func TestStatusRoundTrip(t *testing.T) {
+	in := New(codes.ResourceExhausted, "QUOTA").
+		WithMessage("too many requests").
+		WithDomain("example.com").
+		WithMeta(KeyRequestID, "req").
+		WithRetryDelay(1500*time.Millisecond).
+		WithQuotaViolation("project:1", "daily limit").
+		WithPreconditionViolation("TOS", "example.com/tos", "not accepted").
+		WithResourceInfo("user", "users/1", "", "").
+		WithHelpLink("quota docs", "https://example.com/quota").
+		WithLocalizedMessage("en-US", "Slow down")
+
+	// a foreign service sends the standard details only
+	out, ok := FromError(status.Convert(in).Err())
+	if !ok {
+		t.Fatal("not parsed")
+	}
+	if !proto.Equal(in, out) {
+		t.Errorf("round trip mismatch:\n got: %v\nwant: %v", out, in)
+	}
+
+	in.WithFieldViolation("name", "min_len", "too short")
+	out = MustFromError(status.Convert(in).Err())
+	if !proto.Equal(in, out) {
+		t.Errorf("round trip mismatch:\n got: %v\nwant: %v", out, in)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	errNotFound := New(codes.NotFound, "USER_NOT_FOUND")
+	cause := io.ErrUnexpectedEOF
+	wrapped := New(codes.NotFound, "USER_NOT_FOUND").Wrapf(cause, "user %d not found", 1)
+	err := fmt.Errorf("get user: %w", wrapped)
+
+	if !errors.Is(err, cause) || !errors.Is(err, errNotFound) {
+		t.Error("errors.Is failed")
+	}
+	if errors.Is(err, New(codes.NotFound)) {
+		t.Error("matched a different ID")
+	}
+	noID := New(codes.Internal, "").WithMessage("disk full")
+	if errors.Is(noID, New(codes.Internal, "").WithMessage("timeout")) {
+		t.Error("matched an unrelated error without ID")
+	}
+	if !errors.Is(fmt.Errorf("write: %w", noID), noID) || !errors.Is(noID, New(codes.Internal, "").WithMessage("disk full")) {
+		t.Error("errors without ID and with the same message are not equal")
+	}
+	e, ok := FromError(err)
+	if !ok || e.Message != "user 1 not found" || Cause(err) != cause {
+		t.Errorf("FromError = %v, cause = %v", e, Cause(err))
+	}
+	// the cause never reaches clients
+	if st := status.Convert(wrapped); strings.Contains(st.Message(), cause.Error()) {
+		t.Errorf("cause is serialized: %v", st.Proto())
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	d := Register(&Definition{ID: "TEST_REJECTED", Domain: "test", Code: codes.FailedPrecondition, Message: "%s is rejected"})
+	err := status.Convert(d.New("bye")).Err()
+	if !d.Is(err) || MustFromError(err).Message != "bye is rejected" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got, ok := Lookup("TEST_REJECTED"); !ok || got != d {
+		t.Error("lookup failed")
+	}
+	if err := CheckRegistry(); err != nil {
+		t.Fatal(err)
+	}
+	Register(&Definition{ID: "TEST_REJECTED", Domain: "other", Source: "other/errors.proto"})
+	defer func() { conflicts = nil }()
+	if got, _ := Lookup("TEST_REJECTED"); got != d {
+		t.Error("duplicate ID replaced the registered definition")
+	}
+	if err := CheckRegistry(); err == nil || err.Error() != `error ID TEST_REJECTED of other/errors.proto is already registered by domain "test"` {
+		t.Errorf("CheckRegistry() = %v", err)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	cfg := DefaultRedactionConfig
+	cfg.Enabled = true
+	cfg.Codes = append(cfg.Codes, "DEADLINE_EXCEEDED")
+	r, err := NewRedactor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req"))
+
+	internal := Internalf("db password %s rejected", "secret").WithMeta(KeyStack, "main.go:1")
+	got := MustFromError(r.RedactError(ctx, internal))
+	if got.Message != "internal error (request id: req)" || got.Metadata[KeyStack] != "" || got.Metadata[KeyRequestID] != "req" {
+		t.Errorf("internal error not redacted: %v", got)
+	}
+	if e := MustFromError(r.RedactError(ctx, context.DeadlineExceeded)); !strings.HasPrefix(e.Message, "internal error") {
+		t.Errorf("deadline not redacted: %v", e)
+	}
+
+	notFound := New(codes.NotFound).WithMessage("user not found").WithMeta(KeyStack, "main.go:1")
+	got = r.Redact(ctx, notFound)
+	if got.Message != notFound.Message || got.Metadata[KeyStack] != "" || notFound.Metadata[KeyStack] == "" {
+		t.Errorf("not found error redacted: %v", got)
+	}
+}
+
+func TestProblem(t *testing.T) {
+	handler := gateway_middleware.NewHTTPErrorHandler(gwErrorParser,
+		newGWOptions([]GWOption{WithErrorFormat(gateway_middleware.ErrorFormatNegotiate, "https://errors.example.com/")}).handlerOptions())
+	err := New(codes.InvalidArgument, "BAD_NAME").WithMessage("name is invalid").WithFieldViolation("name", "min_len", "too short")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+	r.Header.Set("Accept", "application/json, application/problem+json")
+	w := httptest.NewRecorder()
+	handler(r.Context(), nil, &runtime.JSONPb{}, w, r, err)
+
+	if ct := w.Header().Get("Content-Type"); ct != gateway_middleware.ProblemContentType {
+		t.Fatalf("content type = %s", ct)
+	}
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"type":     "https://errors.example.com/BAD_NAME",
+		"title":    "BAD_NAME",
+		"status":   float64(http.StatusBadRequest),
+		"detail":   "name is invalid",
+		"instance": "/v1/users",
+		"code":     "InvalidArgument",
+		"id":       "BAD_NAME",
+		"field_violations": []interface{}{
+			map[string]interface{}{"field": "name", "rule": "min_len", "description": "too short"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problem = %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package errorpb
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"pkg.lucas.icu/micro/gateway_middleware"
+)
+
+// Problem converts e into RFC 7807 problem details rendered with the HTTP
+// status of the request r.
+//
+// The type is typeBase followed by the ID with the ID as title, or
+// about:blank with the status text as title if typeBase is empty. The
+// message is the detail, the other fields of e are extension members,
+// e.g. id, domain, metadata and field_violations.
+func (e *Error) Problem(r *http.Request, status int, typeBase string) *gateway_middleware.Problem {
+	p := &gateway_middleware.Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Message,
+		Instance: r.URL.Path,
+	}
+	if typeBase != "" && e.Id != "" {
+		p.Type = typeBase + e.Id
+		p.Title = e.Id
+	}
+	if b, err := (protojson.MarshalOptions{UseProtoNames: true}).Marshal(e); err == nil {
+		_ = json.Unmarshal(b, &p.Extensions)
+	}
+	if p.Extensions == nil {
+		p.Extensions = map[string]interface{}{}
+	}
+	delete(p.Extensions, "message")
+	p.Extensions["code"] = codes.Code(e.Code).String()
+	return p
+}
@@ -0,0 +1,132 @@
+package errorpb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// RedactionConfig configures what is stripped from errors before they leave
+// the process, see Redactor.
+type RedactionConfig struct {
+	Enabled  bool     `mapstructure:"enabled" desc:"replace the messages of server errors with a generic one, for production"`
+	Message  string   `mapstructure:"message" desc:"message of redacted errors, the request ID is appended"`
+	Codes    []string `mapstructure:"codes" desc:"grpc codes of the redacted errors, e.g. Internal or INTERNAL"`
+	Metadata []string `mapstructure:"metadata" desc:"metadata keys removed from all errors"`
+}
+
+var DefaultRedactionConfig = RedactionConfig{
+	Message:  "internal error",
+	Codes:    []string{"Internal", "Unknown", "DataLoss"},
+	Metadata: []string{KeyStack},
+}
+
+// Redactor replaces the message, metadata and details of server errors,
+// e.g. Internal, with a generic message plus the request ID, and removes
+// sensitive metadata from all errors.
+// A nil Redactor keeps errors as is.
+type Redactor struct {
+	codes    map[codes.Code]bool
+	message  string
+	metadata []string
+}
+
+// NewRedactor returns the Redactor of cfg, or nil if cfg is disabled.
+func NewRedactor(cfg RedactionConfig) (*Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	r := &Redactor{
+		codes:    map[codes.Code]bool{},
+		message:  cfg.Message,
+		metadata: cfg.Metadata,
+	}
+	for _, name := range cfg.Codes {
+		c, err := ParseCode(name)
+		if err != nil {
+			return nil, err
+		}
+		r.codes[c] = true
+	}
+	return r, nil
+}
+
+// ParseCode parses a grpc code name, it accepts both `DeadlineExceeded` and `DEADLINE_EXCEEDED`.
+func ParseCode(name string) (codes.Code, error) {
+	var c codes.Code
+	if err := c.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err == nil {
+		return c, nil
+	}
+	for c = codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(c.String(), name) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown grpc code: %s", name)
+}
+
+// Redact returns a redacted copy of e, or e itself if nothing is redacted.
+// The request ID in ctx is added to redacted errors.
+func (r *Redactor) Redact(ctx context.Context, e *Error) *Error {
+	if r == nil || e == nil {
+		return e
+	}
+	if r.codes[codes.Code(e.Code)] {
+		out := New(codes.Code(e.Code), e.Id).WithDomain(e.Domain).WithMessage(r.message).WithContext(ctx)
+		if reqID, ok := e.Metadata[KeyRequestID]; ok {
+			out.WithMeta(KeyRequestID, reqID)
+		}
+		if reqID := out.Metadata[KeyRequestID]; reqID != "" {
+			out.Message += " (request id: " + reqID + ")"
+		}
+		return out
+	}
+	var out *Error
+	for _, key := range r.metadata {
+		if _, ok := e.Metadata[key]; !ok {
+			continue
+		}
+		if out == nil {
+			out = proto.Clone(e).(*Error)
+		}
+		delete(out.Metadata, key)
+	}
+	if out == nil {
+		return e
+	}
+	return out
+}
+
+// RedactError converts err into an Error and redacts it, it returns err
+// itself if nothing is redacted, so that the cause is kept.
+func (r *Redactor) RedactError(ctx context.Context, err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	e := MustFromError(err)
+	if out := r.Redact(ctx, e); out != e {
+		return out
+	}
+	return err
+}
+
+// RecordError records the full err on the span in ctx, so that traces keep
+// the details of redacted errors.
+func RecordError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	e := MustFromError(err)
+	span.RecordError(err, trace.WithAttributes(
+		attribute.String("error.id", e.Id),
+		attribute.String("error.domain", e.Domain),
+		attribute.String("error.message", e.Message),
+	))
+}
@@ -0,0 +1,146 @@
+package errorpb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Definition is a known error, usually generated from proto enums by
+// protoc-gen-go-errors and registered at init.
+type Definition struct {
+	ID     string
+	Domain string
+	Code   codes.Code
+	// Message is the default message, a fmt template of the arguments of New.
+	Message string
+	// HTTPStatus overrides the HTTP status mapped from Code if not 0.
+	HTTPStatus int
+	// Source is the proto file defining the error, if generated.
+	Source string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Definition{}
+	conflicts  []error
+)
+
+// Register adds d to the catalog and returns it.
+// IDs are unique, if the ID of d is already registered, d is not added and
+// the conflict is returned by CheckRegistry.
+func Register(d *Definition) *Definition {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if old, ok := registry[d.ID]; ok {
+		conflicts = append(conflicts, fmt.Errorf("error ID %s of %s is already registered by %s", d.ID, d.origin(), old.origin()))
+		return d
+	}
+	registry[d.ID] = d
+	return d
+}
+
+// CheckRegistry returns the IDs registered more than once, with the proto
+// files or domains defining them. The servers of grpc_module and
+// http_module fail to start on it.
+func CheckRegistry() error {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return errors.Join(conflicts...)
+}
+
+func (d *Definition) origin() string {
+	if d.Source != "" {
+		return d.Source
+	}
+	return fmt.Sprintf("domain %q", d.Domain)
+}
+
+// Lookup returns the registered definition of id.
+func Lookup(id string) (*Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	d, ok := registry[id]
+	return d, ok
+}
+
+// Definitions returns all registered definitions sorted by domain and ID.
+func Definitions() []*Definition {
+	registryMu.RLock()
+	defs := make([]*Definition, 0, len(registry))
+	for _, d := range registry {
+		defs = append(defs, d)
+	}
+	registryMu.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Domain != defs[j].Domain {
+			return defs[i].Domain < defs[j].Domain
+		}
+		return defs[i].ID < defs[j].ID
+	})
+	return defs
+}
+
+// New creates an Error of d, args format the default message, which is
+// used as is without args.
+func (d *Definition) New(args ...interface{}) *Error {
+	msg := d.Message
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	return New(d.Code, d.ID).WithDomain(d.Domain).WithMessage(msg)
+}
+
+// Is reports whether err is an Error of d, also after a grpc round trip.
+func (d *Definition) Is(err error) bool {
+	e, ok := FromError(err)
+	return ok && codes.Code(e.Code) == d.Code && e.Id == d.ID
+}
+
+// httpStatus returns the HTTP status override of the error with id, or 0.
+func httpStatus(id string) int {
+	if d, ok := Lookup(id); ok {
+		return d.HTTPStatus
+	}
+	return 0
+}
+
+type catalogEntry struct {
+	ID         string `json:"id"`
+	Domain     string `json:"domain,omitempty"`
+	Code       string `json:"code"`
+	HTTPStatus int    `json:"http_status"`
+	Message    string `json:"message,omitempty"`
+}
+
+// CatalogHandler serves all registered errors as a json list, e.g. for
+// front-ends to map error IDs to translations.
+func CatalogHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defs := Definitions()
+		entries := make([]catalogEntry, 0, len(defs))
+		for _, d := range defs {
+			st := d.HTTPStatus
+			if st == 0 {
+				st = runtime.HTTPStatusFromCode(d.Code)
+			}
+			entries = append(entries, catalogEntry{
+				ID:         d.ID,
+				Domain:     d.Domain,
+				Code:       d.Code.String(),
+				HTTPStatus: st,
+				Message:    d.Message,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package errorpb
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/status"
+)
+
+// wrapError is an Error with the underlying cause. The cause is kept for
+// logging and errors.Is/As only. GRPCStatus comes from the Error, but grpc
+// uses err.Error() as the status message once the error is wrapped again,
+// e.g. by fmt.Errorf, grpc_errors returns the bare Error to clients.
+type wrapError struct {
+	err   *Error
+	cause error
+}
+
+// Wrap returns e with cause attached, e.g.
+//
+//	errorpb.New(codes.NotFound, "USER_NOT_FOUND").WithMessage("user not found").Wrap(sql.ErrNoRows)
+//
+// errors.Is(err, sql.ErrNoRows) holds for the returned error, and FromError
+// returns e.
+func (e *Error) Wrap(cause error) error {
+	if cause == nil {
+		return e
+	}
+	return &wrapError{err: e, cause: cause}
+}
+
+// Wrapf is like Wrap, and sets the message of e as fmt.Sprintf.
+func (e *Error) Wrapf(cause error, format string, args ...interface{}) error {
+	return e.WithMessage(fmt.Sprintf(format, args...)).Wrap(cause)
+}
+
+// Is reports whether target is an Error of the same code and ID, so that
+// errors.Is(err, ErrUserNotFound) works with predefined errors. Errors
+// without ID also need the same message, unrelated errors of a code are
+// not equal.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || e == nil || t == nil {
+		return false
+	}
+	if e == t {
+		return true
+	}
+	if e.Code != t.Code || e.Id != t.Id {
+		return false
+	}
+	return e.Id != "" || e.Message == t.Message
+}
+
+func (w *wrapError) Error() string {
+	return w.err.Error() + ": " + w.cause.Error()
+}
+
+func (w *wrapError) GRPCStatus() *status.Status {
+	return w.err.GRPCStatus()
+}
+
+func (w *wrapError) Is(target error) bool {
+	return w.err.Is(target)
+}
+
+func (w *wrapError) Unwrap() error {
+	return w.cause
+}
+
+// As makes errors.As find the wrapped Error before the cause.
+func (w *wrapError) As(target interface{}) bool {
+	if t, ok := target.(**Error); ok {
+		*t = w.err
+		return true
+	}
+	return false
+}
+
+// MarshalLogObject implements zap.ObjectMarshaler, the cause is included.
+func (w *wrapError) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if err := w.err.MarshalLogObject(enc); err != nil {
+		return err
+	}
+	enc.AddString("cause", w.cause.Error())
+	return nil
+}
+
+// Cause returns the error wrapped by Wrap, or nil.
+func Cause(err error) error {
+	var w *wrapError
+	if errors.As(err, &w) {
+		return w.cause
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
@@ -20,12 +21,13 @@ import (
 	"pkg.lucas.icu/micro/http_module"
 	"pkg.lucas.icu/micro/svc_module"
 	"pkg.lucas.icu/micro/trace_module"
+	"pkg.lucas.icu/micro/viperutil"
 	"pkg.lucas.icu/micro/zap_module"
 )
 
 // Define a viper compatible config struct
 type Config struct {
-	WelcomeMessage string `mapstructure:"welcome-message" validate:"required"`
+	WelcomeMessage string `mapstructure:"welcome-message" validate:"required" desc:"prefix of the greeting"`
 }
 
 var DefaultConfig = Config{
@@ -35,7 +37,7 @@ var DefaultConfig = Config{
 // should read config from a viper instance
 func readConfig(v *viper.Viper) (Config, error) {
 	cfg := Config{}
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
 		return cfg, err
 	}
 	return cfg, nil
@@ -52,6 +54,9 @@ type server struct {
 
 func (s *server) Hello(ctx context.Context, req *example.HelloReq) (resp *example.HelloResp, err error) {
 	ctxzap.Info(ctx, "received request")
+	if req.GetMessage() == "bye" {
+		return nil, example.ErrorGreetingRejected(req.GetMessage())
+	}
 	return &example.HelloResp{
 		Message: s.msg + " " + req.GetMessage(),
 	}, nil
@@ -65,12 +70,12 @@ func RegisterGRPCService(srv *grpc.Server, svc example.GreeterServer) {
 	example.RegisterGreeterServer(srv, svc)
 }
 
-func RegisterGRPCGateway(lc fx.Lifecycle, cfg grpc_module.Config, gwmux *runtime.ServeMux) error {
+func RegisterGRPCGateway(lc fx.Lifecycle, cfg grpc_module.Config, gwmux *runtime.ServeMux, dialer *grpc_module.Dialer) error {
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) (err error) {
 			return example.RegisterGreeterHandler(context.Background(),
 				gwmux,
-				grpc_module.MustDial(fmt.Sprintf("127.0.0.1:%d", cfg.ListenPort), grpc.WithInsecure()),
+				dialer.MustDial(fmt.Sprintf("127.0.0.1:%d", cfg.ListenPort), grpc.WithInsecure()),
 			)
 		},
 	})
@@ -81,7 +86,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	app := fx.New(
+	opts := []fx.Option{
 		svc_module.Module("example", "example.example.com"),
 		svc_module.WithProjectID("project-example"),
 		cmd_module.Module(false),
@@ -103,6 +108,17 @@ func main() {
 			RegisterGRPCGateway,
 			checkConfig,
 		),
-	)
+	}
+
+	// e.g. `example config sample > config.yaml`
+	if ok, err := cfg_module.RunCommand(os.Args[1:], os.Stdout, opts...); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	app := fx.New(opts...)
 	app.Run()
 }
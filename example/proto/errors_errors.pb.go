@@ -0,0 +1,48 @@
+// Code generated by protoc-gen-go-errors. DO NOT EDIT.
+// source: errors.proto
+
+package proto
+
+import (
+	codes "google.golang.org/grpc/codes"
+	errorpb "pkg.lucas.icu/micro/errorpb"
+)
+
+// The greeting is not welcome.
+var ErrGreetingRejected = errorpb.Register(&errorpb.Definition{
+	ID:      "GREETING_REJECTED",
+	Domain:  "example",
+	Code:    codes.FailedPrecondition,
+	Message: "greeting %q is rejected",
+	Source:  "errors.proto",
+})
+
+// ErrorGreetingRejected creates a GREETING_REJECTED error, args format the default message.
+func ErrorGreetingRejected(arg1 interface{}) *errorpb.Error {
+	return ErrGreetingRejected.New(arg1)
+}
+
+// IsGreetingRejected reports whether err is a GREETING_REJECTED error.
+func IsGreetingRejected(err error) bool {
+	return ErrGreetingRejected.Is(err)
+}
+
+// Too many greetings.
+var ErrTooManyGreetings = errorpb.Register(&errorpb.Definition{
+	ID:         "TOO_MANY_GREETINGS",
+	Domain:     "example",
+	Code:       codes.ResourceExhausted,
+	Message:    "too many greetings",
+	HTTPStatus: 429,
+	Source:     "errors.proto",
+})
+
+// ErrorTooManyGreetings creates a TOO_MANY_GREETINGS error.
+func ErrorTooManyGreetings() *errorpb.Error {
+	return ErrTooManyGreetings.New()
+}
+
+// IsTooManyGreetings reports whether err is a TOO_MANY_GREETINGS error.
+func IsTooManyGreetings(err error) bool {
+	return ErrTooManyGreetings.Is(err)
+}
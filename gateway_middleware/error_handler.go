@@ -2,6 +2,7 @@ package gateway_middleware
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -15,8 +16,8 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-func NewRoutingErrorHandler(statusToErr func(int) error, f func(err error) (codes.Code, proto.Message)) func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
-	handler := NewHTTPErrorHandler(f)
+func NewRoutingErrorHandler(statusToErr func(int) error, f func(err error) (codes.Code, proto.Message), opts ...HandlerOption) func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	handler := NewHTTPErrorHandler(f, opts...)
 	return func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
 		err := statusToErr(httpStatus)
 		handler(ctx, mux, marshaler, w, r, err)
@@ -24,7 +25,8 @@ func NewRoutingErrorHandler(statusToErr func(int) error, f func(err error) (code
 }
 
 // copied from geteway
-func NewHTTPErrorHandler(f func(err error) (codes.Code, proto.Message)) func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+func NewHTTPErrorHandler(f func(err error) (codes.Code, proto.Message), opts ...HandlerOption) func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	o := newHandlerOptions(opts)
 	return func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
 		// return Internal when Marshal failed
 		const fallback = `{"code": 13, "message": "failed to marshal error message"}`
@@ -35,14 +37,23 @@ func NewHTTPErrorHandler(f func(err error) (codes.Code, proto.Message)) func(ctx
 		}
 
 		code, pb := f(err)
+		st := runtime.HTTPStatusFromCode(code)
+		if customStatus != nil {
+			st = customStatus.HTTPStatus
+		}
 
 		w.Header().Del("Trailer")
 		w.Header().Del("Transfer-Encoding")
 
-		contentType := marshaler.ContentType(pb)
-		w.Header().Set("Content-Type", contentType)
-
-		buf, merr := marshaler.Marshal(pb)
+		var buf []byte
+		var merr error
+		if o.problem(r) {
+			w.Header().Set("Content-Type", ProblemContentType)
+			buf, merr = json.Marshal(o.toProblem(r, st, err))
+		} else {
+			w.Header().Set("Content-Type", marshaler.ContentType(pb))
+			buf, merr = marshaler.Marshal(pb)
+		}
 		if merr != nil {
 			grpclog.Errorf("Failed to marshal error message %q: %v", pb, merr)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -71,11 +82,6 @@ func NewHTTPErrorHandler(f func(err error) (codes.Code, proto.Message)) func(ctx
 			w.Header().Set("Transfer-Encoding", "chunked")
 		}
 
-		st := runtime.HTTPStatusFromCode(code)
-		if customStatus != nil {
-			st = customStatus.HTTPStatus
-		}
-
 		w.WriteHeader(st)
 		if _, err := w.Write(buf); err != nil {
 			grpclog.Infof("Failed to write response: %v", err)
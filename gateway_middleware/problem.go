@@ -0,0 +1,106 @@
+package gateway_middleware
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Formats of the error responses.
+const (
+	// ErrorFormatProto renders the error message as is.
+	ErrorFormatProto = "proto"
+	// ErrorFormatProblem renders RFC 7807 problem details.
+	ErrorFormatProblem = "problem"
+	// ErrorFormatNegotiate renders problem details only if the request
+	// accepts application/problem+json, otherwise the error message.
+	ErrorFormatNegotiate = "negotiate"
+)
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions are extra members, they never override the members above.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler, extensions are inlined.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// ProblemFunc converts err, which is rendered with the HTTP status, into problem details.
+type ProblemFunc func(r *http.Request, status int, err error) *Problem
+
+type handlerOptions struct {
+	format    string
+	toProblem ProblemFunc
+}
+
+// HandlerOption configures the error handlers.
+type HandlerOption func(o *handlerOptions)
+
+// WithProblem renders errors as problem details converted by f according to
+// format, one of ErrorFormatProto, ErrorFormatProblem and ErrorFormatNegotiate.
+func WithProblem(format string, f ProblemFunc) HandlerOption {
+	return func(o *handlerOptions) {
+		o.format = format
+		o.toProblem = f
+	}
+}
+
+func newHandlerOptions(opts []HandlerOption) *handlerOptions {
+	o := &handlerOptions{format: ErrorFormatProto}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// problem reports whether the error response to r is rendered as problem details.
+func (o *handlerOptions) problem(r *http.Request) bool {
+	if o.toProblem == nil {
+		return false
+	}
+	switch o.format {
+	case ErrorFormatProblem:
+		return true
+	case ErrorFormatNegotiate:
+		return AcceptsProblem(r)
+	}
+	return false
+}
+
+// AcceptsProblem reports whether r explicitly accepts application/problem+json.
+func AcceptsProblem(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mt == ProblemContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package gateway_module
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/labstack/echo/v4"
@@ -8,12 +11,20 @@ import (
 	"go.uber.org/fx"
 	"google.golang.org/protobuf/encoding/protojson"
 	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/errorpb"
+	"pkg.lucas.icu/micro/gateway_middleware"
+	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
+	"pkg.lucas.icu/micro/http_module"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/viperutil"
 )
 
 type Config struct {
-	UseProtoNames   bool `mapstructure:"use-proto-names"`
-	EmitUnpopulated bool `mapstructure:"emit-unpopulated"`
-	DiscardUnknown  bool `mapstructure:"discard-unknown"`
+	UseProtoNames   bool   `mapstructure:"use-proto-names"`
+	EmitUnpopulated bool   `mapstructure:"emit-unpopulated"`
+	DiscardUnknown  bool   `mapstructure:"discard-unknown"`
+	ErrorFormat     string `mapstructure:"error-format" validate:"oneof=proto problem negotiate" desc:"proto renders errorpb.Error, problem renders RFC 7807 problem+json, negotiate renders problem+json when accepted"`
+	ProblemTypeBase string `mapstructure:"problem-type-base" desc:"problem type URI prefix followed by the error ID, about:blank when empty"`
 }
 
 var DefaultConfig = wrappedCfg{
@@ -21,6 +32,7 @@ var DefaultConfig = wrappedCfg{
 		UseProtoNames:   true,
 		EmitUnpopulated: true,
 		DiscardUnknown:  true,
+		ErrorFormat:     gateway_middleware.ErrorFormatNegotiate,
 	},
 }
 
@@ -30,7 +42,7 @@ type wrappedCfg struct {
 
 func ReadConfig(v *viper.Viper) (Config, error) {
 	cfg := &wrappedCfg{}
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
 		return Config{}, err
 	}
 	return cfg.GW, nil
@@ -53,19 +65,46 @@ func Module() fx.Option {
 	)
 }
 
-func customMatcher(key string) (string, bool) {
-	switch key {
-	case "x-request-id":
-		return key, true
-	default:
+// headerMatchers forward the request ID header to grpc, and drop it from
+// grpc response headers since echo returns it already. The headers of the
+// propagated values are not forwarded, also as Grpc-Metadata-*, the clients
+// created by grpc_module.Dialer add them from the context instead, where they
+// may have been rewritten, e.g. by tenant_module.
+func headerMatchers(requestID string, propagated []string) (incoming, outgoing runtime.HeaderMatcherFunc) {
+	requestID = strings.ToLower(requestID)
+	dropped := map[string]bool{}
+	for _, h := range propagated {
+		h = strings.ToLower(h)
+		dropped[h] = true
+		dropped[strings.ToLower(runtime.MetadataHeaderPrefix)+h] = true
+	}
+	incoming = func(key string) (string, bool) {
+		switch k := strings.ToLower(key); {
+		case k == requestID:
+			return k, true
+		case dropped[k]:
+			return "", false
+		}
 		return runtime.DefaultHeaderMatcher(key)
 	}
+	outgoing = func(key string) (string, bool) {
+		if strings.ToLower(key) == requestID {
+			return "", false
+		}
+		return fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, key), true
+	}
+	return incoming, outgoing
 }
 
 type runtimeOptionsParams struct {
 	fx.In
 
-	Options []runtime.ServeMuxOption `group:"grpc_gateway_options"`
+	Options    []runtime.ServeMuxOption       `group:"grpc_gateway_options"`
+	HttpCfg    http_module.Config             `optional:"true"`
+	Propagator *propagation_module.Propagator `optional:"true"`
+	// ErrorRedactor of http.error-redaction, shared with the error handler
+	// of echo
+	ErrorRedactor *errorpb.Redactor `optional:"true"`
 }
 
 type runtimeOptions struct {
@@ -78,7 +117,28 @@ func WithGWOptions(opts ...runtime.ServeMuxOption) fx.Option {
 	return fx.Supply(runtimeOptions{Options: opts})
 }
 
-func NewGatewayMux(cfg Config, opts runtimeOptionsParams) *runtime.ServeMux {
+func (cfg Config) marshaler() runtime.Marshaler {
+	return &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			UseProtoNames:   cfg.UseProtoNames,
+			EmitUnpopulated: cfg.EmitUnpopulated,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: cfg.DiscardUnknown,
+		},
+	}
+}
+
+func (cfg Config) errorOptions(redactor *errorpb.Redactor) []errorpb.GWOption {
+	return []errorpb.GWOption{
+		errorpb.WithRedactor(redactor),
+		errorpb.WithErrorFormat(cfg.ErrorFormat, cfg.ProblemTypeBase),
+	}
+}
+
+func NewGatewayMux(cfg Config, opts runtimeOptionsParams) (*runtime.ServeMux, error) {
+	errOpts := cfg.errorOptions(opts.ErrorRedactor)
+
 	// f := func(err error) (codes.Code, proto.Message) {
 	// 	pb := errorpb.MustFromError(err)
 	// 	return errorpb.Code(pb), pb
@@ -96,19 +156,20 @@ func NewGatewayMux(cfg Config, opts runtimeOptionsParams) *runtime.ServeMux {
 	// 	return err
 	// }
 
+	header := opts.HttpCfg.RequestID.Header
+	if header == "" {
+		header = request_id.DefaultConfig.Header
+	}
+	incoming, outgoing := headerMatchers(header, opts.Propagator.Headers())
+
 	gwopts := []runtime.ServeMuxOption{
 		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.HTTPBodyMarshaler{
-			Marshaler: &runtime.JSONPb{
-				MarshalOptions: protojson.MarshalOptions{
-					UseProtoNames:   cfg.UseProtoNames,
-					EmitUnpopulated: cfg.EmitUnpopulated,
-				},
-				UnmarshalOptions: protojson.UnmarshalOptions{
-					DiscardUnknown: cfg.DiscardUnknown,
-				},
-			},
+			Marshaler: cfg.marshaler(),
 		}),
-		runtime.WithIncomingHeaderMatcher(customMatcher),
+		runtime.WithIncomingHeaderMatcher(incoming),
+		runtime.WithOutgoingHeaderMatcher(outgoing),
+		errorpb.GrpcGWErrorHandler(errOpts...),
+		errorpb.GrpcGWRoutingErrorHandler(errOpts...),
 	}
 	gwopts = append(gwopts, opts.Options...)
 
@@ -130,9 +191,11 @@ func NewGatewayMux(cfg Config, opts runtimeOptionsParams) *runtime.ServeMux {
 	// runtime.WithIncomingHeaderMatcher(customMatcher),
 	)
 
-	return gwmux
+	return gwmux, nil
 }
 
-func RegisterGateway(e *echo.Echo, gwmux *runtime.ServeMux) {
+func RegisterGateway(e *echo.Echo, gwmux *runtime.ServeMux, cfg Config, redactor *errorpb.Redactor) {
+	// render the errors of plain echo handlers like the gateway
+	e.HTTPErrorHandler = http_module.HTTPErrorHandler(cfg.marshaler(), cfg.errorOptions(redactor)...)
 	e.Any("/*", echo.WrapHandler(gwmux))
 }
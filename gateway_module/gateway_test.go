@@ -0,0 +1,20 @@
+package gateway_module
+
+import "testing"
+
+func TestHeaderMatchers(t *testing.T) {
+	incoming, outgoing := headerMatchers("X-Request-Id", []string{"x-tenant-id"})
+	for key, want := range map[string]string{
+		"X-Request-Id":              "x-request-id",
+		"X-Tenant-Id":               "",
+		"Grpc-Metadata-X-Tenant-Id": "",
+		"Grpc-Metadata-X-Other":     "X-Other",
+	} {
+		if got, _ := incoming(key); got != want {
+			t.Errorf("incoming(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := outgoing("x-request-id"); ok {
+		t.Error("outgoing request ID is forwarded")
+	}
+}
@@ -0,0 +1,52 @@
+package grpc_errors
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+// UnaryServerInterceptor returns a new unary server interceptor that redacts
+// the returned errors with r before they leave the process.
+//
+// Errors wrapping an Error are replaced by the Error, so that their causes
+// never reach clients.
+//
+// Put it after request_id, and before recovery and logging so that logs
+// keep the full errors. The full errors are also recorded on the span.
+func UnaryServerInterceptor(r *errorpb.Redactor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			err = redact(ctx, r, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor that
+// redacts the returned errors, see UnaryServerInterceptor.
+func StreamServerInterceptor(r *errorpb.Redactor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, stream); err != nil {
+			return redact(stream.Context(), r, err)
+		}
+		return nil
+	}
+}
+
+func redact(ctx context.Context, r *errorpb.Redactor, err error) error {
+	out := r.RedactError(ctx, err)
+	if out != err {
+		errorpb.RecordError(ctx, err)
+	}
+	// grpc takes the status message of an error wrapping an Error, e.g. by
+	// fmt.Errorf or Wrap, from err.Error(), which includes the causes
+	var e *errorpb.Error
+	if errors.As(out, &e) && out != error(e) {
+		return e
+	}
+	return out
+}
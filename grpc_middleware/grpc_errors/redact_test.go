@@ -0,0 +1,44 @@
+package grpc_errors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+func TestWrappedCause(t *testing.T) {
+	wrapped := fmt.Errorf("get user: %w", errorpb.New(codes.NotFound, "USER_NOT_FOUND").WithMessage("user not found").Wrap(sql.ErrNoRows))
+	// grpc builds the message from err.Error() without the interceptor
+	if st := status.Convert(wrapped); !strings.Contains(st.Message(), sql.ErrNoRows.Error()) {
+		t.Fatalf("status.Convert() = %v", st.Proto())
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, wrapped }
+	for _, r := range []*errorpb.Redactor{nil, mustRedactor(t)} {
+		_, err := UnaryServerInterceptor(r)(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+		st := status.Convert(err)
+		if st.Code() != codes.NotFound || st.Message() != "user not found" {
+			t.Errorf("status.Convert() = %v", st.Proto())
+		}
+		if e := errorpb.MustFromError(st.Err()); e.Id != "USER_NOT_FOUND" {
+			t.Errorf("FromError() = %v", e)
+		}
+	}
+}
+
+func mustRedactor(t *testing.T) *errorpb.Redactor {
+	cfg := errorpb.DefaultRedactionConfig
+	cfg.Enabled = true
+	r, err := errorpb.NewRedactor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,166 @@
+package grpc_validator
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+type responseOption struct {
+	all     bool
+	fail    bool
+	methods map[string]bool
+	logger  *zap.Logger
+}
+
+type ResponseOption func(o *responseOption)
+
+// WithResponseAll reports all violations of a response instead of the first one.
+func WithResponseAll(all bool) ResponseOption {
+	return func(o *responseOption) {
+		o.all = all
+	}
+}
+
+// WithResponseFail fails the call with `Internal` when a response is invalid,
+// otherwise the violation is only logged.
+func WithResponseFail(fail bool) ResponseOption {
+	return func(o *responseOption) {
+		o.fail = fail
+	}
+}
+
+// WithResponseMethods validates only the responses of the given full method
+// names, e.g. `/pkg.Service/Method`. All methods are validated by default.
+func WithResponseMethods(methods ...string) ResponseOption {
+	return func(o *responseOption) {
+		for _, m := range methods {
+			o.methods[m] = true
+		}
+	}
+}
+
+// WithResponseLogger sets the logger of violations, the logger in context
+// (see ctxzap) is used by default.
+func WithResponseLogger(logger *zap.Logger) ResponseOption {
+	return func(o *responseOption) {
+		o.logger = logger
+	}
+}
+
+func newResponseOption(opts []ResponseOption) *responseOption {
+	opt := &responseOption{methods: map[string]bool{}}
+	for _, fn := range opts {
+		fn(opt)
+	}
+	return opt
+}
+
+// check validates resp of method, it returns an error only in fail mode.
+func (o *responseOption) check(ctx context.Context, method string, resp interface{}) error {
+	if len(o.methods) > 0 && !o.methods[method] {
+		return nil
+	}
+	err := validate(resp, o.all, func(e error) error { return e })
+	if err == nil {
+		return nil
+	}
+	if o.fail {
+		return errorpb.New(codes.Internal).
+			WithMessage("invalid response: " + err.Error()).
+			WithContext(ctx)
+	}
+	logger := o.logger
+	if logger == nil {
+		logger = ctxzap.Extract(ctx)
+	}
+	fields := []zap.Field{zap.String("grpc.full_method", method), zap.Error(err)}
+	if verr, ok := err.(*ValidationError); ok {
+		fields = append(fields, zap.Any("grpc.response.violations", verr.Violations))
+	}
+	logger.Warn("response violates the proto contract", fields...)
+	return nil
+}
+
+// ResponseUnaryServerInterceptor returns a new unary server interceptor that
+// validates the responses of handlers.
+//
+// It is meant for debugging and staging, invalid responses are logged, or
+// replaced by `Internal` errors with WithResponseFail.
+func ResponseUnaryServerInterceptor(opts ...ResponseOption) grpc.UnaryServerInterceptor {
+	opt := newResponseOption(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if err := opt.check(ctx, info.FullMethod, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// ResponseStreamServerInterceptor returns a new streaming server interceptor
+// that validates the messages sent by handlers, see ResponseUnaryServerInterceptor.
+func ResponseStreamServerInterceptor(opts ...ResponseOption) grpc.StreamServerInterceptor {
+	opt := newResponseOption(opts)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &sendWrapper{opt: opt, method: info.FullMethod, ServerStream: stream})
+	}
+}
+
+type sendWrapper struct {
+	opt    *responseOption
+	method string
+	grpc.ServerStream
+}
+
+func (s *sendWrapper) SendMsg(m interface{}) error {
+	if err := s.opt.check(s.Context(), s.method, m); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// ResponseUnaryClientInterceptor returns a new unary client interceptor that
+// validates the responses received from servers, see ResponseUnaryServerInterceptor.
+func ResponseUnaryClientInterceptor(opts ...ResponseOption) grpc.UnaryClientInterceptor {
+	opt := newResponseOption(opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		return opt.check(ctx, method, reply)
+	}
+}
+
+// ResponseStreamClientInterceptor returns a new streaming client interceptor
+// that validates the messages received from servers, see ResponseUnaryServerInterceptor.
+func ResponseStreamClientInterceptor(opts ...ResponseOption) grpc.StreamClientInterceptor {
+	opt := newResponseOption(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &clientRecvWrapper{opt: opt, method: method, ClientStream: stream}, nil
+	}
+}
+
+type clientRecvWrapper struct {
+	opt    *responseOption
+	method string
+	grpc.ClientStream
+}
+
+func (s *clientRecvWrapper) RecvMsg(m interface{}) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.opt.check(s.Context(), s.method, m)
+}
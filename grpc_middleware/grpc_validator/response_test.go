@@ -0,0 +1,95 @@
+package grpc_validator
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+const method = "/pkg.Service/Get"
+
+type serverStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *serverStream) Context() context.Context { return context.Background() }
+func (s *serverStream) SendMsg(interface{}) error {
+	s.sent++
+	return nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) Context() context.Context  { return context.Background() }
+func (s *clientStream) RecvMsg(interface{}) error { return nil }
+
+func TestResponse(t *testing.T) {
+	ctx := context.Background()
+	invalid := legacyReq{Error: &errorpb.Error{}, err: pgvErr{field: "Id", reason: "value length must be at least 1 runes"}}
+	valid := legacyReq{Error: &errorpb.Error{}}
+	calls := map[string]func(resp legacyReq, opts ...ResponseOption) error{
+		"unary server": func(resp legacyReq, opts ...ResponseOption) error {
+			_, err := ResponseUnaryServerInterceptor(opts...)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+				func(context.Context, interface{}) (interface{}, error) { return resp, nil })
+			return err
+		},
+		"stream server": func(resp legacyReq, opts ...ResponseOption) error {
+			stream := &serverStream{}
+			err := ResponseStreamServerInterceptor(opts...)(nil, stream, &grpc.StreamServerInfo{FullMethod: method},
+				func(_ interface{}, s grpc.ServerStream) error { return s.SendMsg(resp) })
+			if err == nil && stream.sent != 1 {
+				t.Errorf("valid or logged message is not sent")
+			}
+			if err != nil && stream.sent != 0 {
+				t.Errorf("invalid message is sent in fail mode")
+			}
+			return err
+		},
+		"unary client": func(resp legacyReq, opts ...ResponseOption) error {
+			return ResponseUnaryClientInterceptor(opts...)(ctx, method, nil, resp, nil,
+				func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+					return nil
+				})
+		},
+		"stream client": func(resp legacyReq, opts ...ResponseOption) error {
+			stream, err := ResponseStreamClientInterceptor(opts...)(ctx, &grpc.StreamDesc{}, nil, method,
+				func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+					return &clientStream{}, nil
+				})
+			if err != nil {
+				return err
+			}
+			return stream.RecvMsg(resp)
+		},
+	}
+	for name, call := range calls {
+		core, logs := observer.New(zapcore.WarnLevel)
+		logger := zap.New(core)
+
+		if err := call(valid, WithResponseFail(true)); err != nil {
+			t.Errorf("%s: valid response = %v", name, err)
+		}
+		if err := call(invalid, WithResponseFail(true)); status.Code(err) != codes.Internal {
+			t.Errorf("%s: invalid response in fail mode = %v, want Internal", name, err)
+		}
+		if err := call(invalid, WithResponseMethods("/pkg.Service/Other"), WithResponseFail(true)); err != nil {
+			t.Errorf("%s: response of an unselected method = %v", name, err)
+		}
+		if err := call(invalid, WithResponseLogger(logger)); err != nil {
+			t.Errorf("%s: invalid response in log mode = %v", name, err)
+		}
+		if entries := logs.All(); len(entries) != 1 || entries[0].ContextMap()["grpc.full_method"] != method {
+			t.Errorf("%s: logged %v, want one violation of %s", name, entries, method)
+		}
+	}
+}
@@ -5,10 +5,11 @@ package grpc_validator
 
 import (
 	"context"
+	"errors"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"pkg.lucas.icu/micro/errorpb"
 )
 
 type option struct {
@@ -18,8 +19,20 @@ type option struct {
 
 type Option func(o *option)
 
+// defaultErrTransformer converts e into an InvalidArgument errorpb.Error
+// with the field violations of e.
 func defaultErrTransformer(e error) error {
-	return status.Error(codes.InvalidArgument, e.Error())
+	err := errorpb.New(codes.InvalidArgument).WithMessage(e.Error())
+	var verr *ValidationError
+	if errors.As(e, &verr) {
+		for _, v := range verr.Violations {
+			err.WithFieldViolation(v.Field, v.Rule, v.Description)
+		}
+		if len(verr.Violations) > 0 {
+			err.WithMeta(errorpb.KeyInfoField, verr.Violations[0].Field)
+		}
+	}
+	return err
 }
 
 func WithAll(all bool) Option {
@@ -28,6 +41,8 @@ func WithAll(all bool) Option {
 	}
 }
 
+// WithErrTransformer sets the function that converts validation errors,
+// which are *ValidationError, into the returned errors.
 func WithErrTransformer(fn func(error) error) Option {
 	return func(o *option) {
 		o.errTransformer = fn
@@ -56,16 +71,16 @@ func validate(req interface{}, all bool, errorTransformer func(error) error) err
 		switch v := req.(type) {
 		case validateAller:
 			if err := v.ValidateAll(); err != nil {
-				return status.Error(codes.InvalidArgument, err.Error())
+				return errorTransformer(newValidationError(req, err))
 			}
 		case validator:
 			if err := v.Validate(true); err != nil {
-				return status.Error(codes.InvalidArgument, err.Error())
+				return errorTransformer(newValidationError(req, err))
 			}
 		case validatorLegacy:
 			// Fallback to legacy validator
 			if err := v.Validate(); err != nil {
-				return status.Error(codes.InvalidArgument, err.Error())
+				return errorTransformer(newValidationError(req, err))
 			}
 		}
 		return nil
@@ -73,11 +88,11 @@ func validate(req interface{}, all bool, errorTransformer func(error) error) err
 	switch v := req.(type) {
 	case validatorLegacy:
 		if err := v.Validate(); err != nil {
-			return status.Error(codes.InvalidArgument, err.Error())
+			return errorTransformer(newValidationError(req, err))
 		}
 	case validator:
 		if err := v.Validate(false); err != nil {
-			return status.Error(codes.InvalidArgument, err.Error())
+			return errorTransformer(newValidationError(req, err))
 		}
 	}
 	return nil
@@ -0,0 +1,200 @@
+package grpc_validator
+
+import (
+	"errors"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FieldViolation describes a field of a message that failed validation.
+type FieldViolation struct {
+	// Field is the path to the field using proto field names, e.g. `user.emails[0]`.
+	Field string
+	// Rule is the protoc-gen-validate rule that failed, e.g. `min_len`.
+	// protoc-gen-validate does not expose it, so it is guessed from the
+	// reason and is `invalid` when unknown.
+	Rule        string
+	Description string
+}
+
+// ValidationError is the error passed to the errTransformer when a message
+// fails validation.
+type ValidationError struct {
+	Violations []FieldViolation
+	err        error
+}
+
+func (e *ValidationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.err
+}
+
+// pgvError is implemented by the errors generated by protoc-gen-validate.
+type pgvError interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+}
+
+// pgvMultiError is implemented by the errors returned by ValidateAll.
+type pgvMultiError interface {
+	AllErrors() []error
+}
+
+func newValidationError(req interface{}, err error) *ValidationError {
+	var desc protoreflect.MessageDescriptor
+	if m, ok := req.(proto.Message); ok {
+		desc = m.ProtoReflect().Descriptor()
+	}
+	return &ValidationError{
+		Violations: fieldViolations(err, desc, ""),
+		err:        err,
+	}
+}
+
+func fieldViolations(err error, desc protoreflect.MessageDescriptor, prefix string) []FieldViolation {
+	var multi pgvMultiError
+	if errors.As(err, &multi) {
+		var vs []FieldViolation
+		for _, e := range multi.AllErrors() {
+			vs = append(vs, fieldViolations(e, desc, prefix)...)
+		}
+		return vs
+	}
+	var pe pgvError
+	if !errors.As(err, &pe) {
+		return []FieldViolation{{Field: prefix, Rule: "invalid", Description: err.Error()}}
+	}
+	field, fd := fieldPath(pe.Field(), desc)
+	path := field
+	if prefix != "" {
+		path = prefix + "." + field
+	}
+	// embedded messages report the violations of their own fields as cause
+	if pe.Cause() != nil {
+		var sub protoreflect.MessageDescriptor
+		if fd != nil {
+			sub = fd.Message()
+			if fd.IsMap() {
+				sub = fd.MapValue().Message()
+			}
+		}
+		return fieldViolations(pe.Cause(), sub, path)
+	}
+	rule := ruleOf(pe.Reason())
+	if pe.Key() {
+		rule = "keys." + rule
+	}
+	return []FieldViolation{{Field: path, Rule: rule, Description: pe.Reason()}}
+}
+
+// fieldPath converts the Go field name reported by protoc-gen-validate,
+// e.g. `Emails[0]`, into the proto field name found in desc.
+func fieldPath(name string, desc protoreflect.MessageDescriptor) (string, protoreflect.FieldDescriptor) {
+	goName, index := name, ""
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		goName, index = name[:i], name[i:]
+	}
+	if desc != nil {
+		fields := desc.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			if goCamelCase(string(fd.Name())) == goName {
+				return string(fd.Name()) + index, fd
+			}
+		}
+	}
+	return snakeCase(goName) + index, nil
+}
+
+// goCamelCase is how protoc-gen-go names the Go field of a proto field.
+func goCamelCase(s string) string {
+	b := strings.Builder{}
+	upper := true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_':
+			upper = true
+			continue
+		case c >= '0' && c <= '9':
+			upper = true
+		case upper && c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+			upper = false
+		default:
+			upper = false
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func snakeCase(s string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// reasonRules maps the reasons generated by protoc-gen-validate to the rules,
+// more specific reasons come first.
+var reasonRules = []struct {
+	reason string
+	rule   string
+}{
+	{"value is required", "required"},
+	{"embedded message failed validation", "message"},
+	{"length must be at least", "min_len"},
+	{"length must be at most", "max_len"},
+	{"length must be", "len"},
+	{"must contain at least", "min_items"},
+	{"must contain no more than", "max_items"},
+	{"must contain unique items", "unique"},
+	{"must be greater than or equal to", "gte"},
+	{"must be greater than", "gt"},
+	{"must be less than or equal to", "lte"},
+	{"must be less than", "lt"},
+	{"must be inside range", "range"},
+	{"must be outside range", "range"},
+	{"must not be in list", "not_in"},
+	{"must be in list", "in"},
+	{"must equal", "const"},
+	{"does not match regex pattern", "pattern"},
+	{"does not have prefix", "prefix"},
+	{"does not have suffix", "suffix"},
+	{"does not contain substring", "contains"},
+	{"contains substring", "not_contains"},
+	{"valid email", "email"},
+	{"valid hostname", "hostname"},
+	{"valid IPv4", "ipv4"},
+	{"valid IPv6", "ipv6"},
+	{"valid IP", "ip"},
+	{"valid URI", "uri"},
+	{"absolute URI", "uri"},
+	{"valid UUID", "uuid"},
+	{"defined enum value", "defined_only"},
+}
+
+func ruleOf(reason string) string {
+	for _, r := range reasonRules {
+		if strings.Contains(reason, r.reason) {
+			return r.rule
+		}
+	}
+	return "invalid"
+}
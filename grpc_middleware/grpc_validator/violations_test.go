@@ -0,0 +1,65 @@
+package grpc_validator
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+type pgvErr struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e pgvErr) Field() string  { return e.field }
+func (e pgvErr) Reason() string { return e.reason }
+func (e pgvErr) Key() bool      { return false }
+func (e pgvErr) Cause() error   { return e.cause }
+func (e pgvErr) Error() string  { return e.field + ": " + e.reason }
+
+type pgvMultiErr []error
+
+func (m pgvMultiErr) Error() string      { return "multiple errors" }
+func (m pgvMultiErr) AllErrors() []error { return m }
+
+type legacyReq struct {
+	*errorpb.Error
+	err error
+}
+
+func (r legacyReq) Validate() error { return r.err }
+
+func TestFieldViolations(t *testing.T) {
+	// errorpb.Error is used as the request for its nested fields
+	req := legacyReq{Error: &errorpb.Error{}, err: pgvMultiErr{
+		pgvErr{field: "Id", reason: "value length must be at least 1 runes"},
+		pgvErr{field: "FieldViolations[1]", reason: "embedded message failed validation", cause: pgvErr{
+			field: "Description", reason: "value does not match regex pattern \"^a\"",
+		}},
+	}}
+	err := validate(req, false, defaultErrTransformer)
+
+	// round trip through grpc status, as the gateway receives it
+	e, ok := errorpb.FromError(status.Convert(err).Err())
+	if !ok || codes.Code(e.Code) != codes.InvalidArgument {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []errorpb.FieldViolation{
+		{Field: "id", Rule: "min_len", Description: "value length must be at least 1 runes"},
+		{Field: "field_violations[1].description", Rule: "pattern", Description: "value does not match regex pattern \"^a\""},
+	}
+	if len(e.FieldViolations) != len(want) {
+		t.Fatalf("got %d violations: %v", len(e.FieldViolations), e.FieldViolations)
+	}
+	for i, v := range e.FieldViolations {
+		if v.Field != want[i].Field || v.Rule != want[i].Rule || v.Description != want[i].Description {
+			t.Errorf("violation %d = %v, want %v", i, v, &want[i])
+		}
+	}
+	if e.Metadata[errorpb.KeyInfoField] != "id" {
+		t.Errorf("form field = %q", e.Metadata[errorpb.KeyInfoField])
+	}
+}
@@ -0,0 +1,119 @@
+package grpc_zap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/lixin9311/zapx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
+	"pkg.lucas.icu/micro/propagation_module"
+)
+
+// UnaryClientInterceptor returns a new unary client interceptor that logs
+// outbound calls with logger. The fields of the calls are under grpc.client,
+// and the trace, request ID and propagated values of the calling context are
+// logged, so that downstream calls can be found by the inbound request. The
+// fields of the inbound request logger (see ctxzap), e.g. its payload, are
+// not inherited.
+func UnaryClientInterceptor(logger *zap.Logger, logPayload bool, opts ...Option) grpc.UnaryClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		startTime := time.Now()
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+
+		fields := clientFields(ctx, cc, method)
+		if logPayload {
+			if pb, ok := req.(proto.Message); ok {
+				fields = append(fields, zap.Reflect("grpc.client.request", &jsonpbObjectMarshaler{pb: pb, redactor: o.redactor}))
+			}
+			if pb, ok := reply.(proto.Message); ok && err == nil {
+				fields = append(fields, zap.Reflect("grpc.client.response", &jsonpbObjectMarshaler{pb: pb, redactor: o.redactor}))
+			}
+		}
+		o.logClientCall(logger, method, err, time.Since(startTime), fields)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a new streaming client interceptor that
+// logs outbound streams when they end, see UnaryClientInterceptor.
+// Payloads are not logged.
+func StreamClientInterceptor(logger *zap.Logger, opts ...Option) grpc.StreamClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		startTime := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			o.logClientCall(logger, method, err, time.Since(startTime), clientFields(ctx, cc, method))
+			return nil, err
+		}
+		return &loggingClientStream{
+			ClientStream:  stream,
+			serverStreams: desc.ServerStreams,
+			log: func(err error) {
+				o.logClientCall(logger, method, err, time.Since(startTime), clientFields(ctx, cc, method))
+			},
+		}, nil
+	}
+}
+
+type loggingClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	log           func(err error)
+}
+
+func (s *loggingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	// the only response of a client stream ends it
+	if err != nil || !s.serverStreams {
+		s.once.Do(func() {
+			if errors.Is(err, io.EOF) {
+				s.log(nil)
+			} else {
+				s.log(err)
+			}
+		})
+	}
+	return err
+}
+
+func clientFields(ctx context.Context, cc *grpc.ClientConn, method string) []zap.Field {
+	fields := []zap.Field{
+		zap.String("grpc.client.target", cc.Target()),
+		zap.String("grpc.client.service", path.Dir(method)[1:]),
+		zap.String("grpc.client.method", path.Base(method)),
+		zapx.Context(ctx),
+		propagation_module.Field(ctx),
+	}
+	id := request_id.ExtractRequestID(ctx)
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(request_id.RequestIDMetadataKey)) > 0 {
+		id = md.Get(request_id.RequestIDMetadataKey)[0]
+	}
+	if id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	return fields
+}
+
+func (o *options) logClientCall(logger *zap.Logger, method string, err error, latency time.Duration, fields []zap.Field) {
+	code := status.Code(err)
+	level := o.levels.Apply(o.codeToLevel(code), code == codes.OK, method)
+	fields = append(fields,
+		zap.String("grpc.client.code", code.String()),
+		zap.Duration("grpc.client.latency", latency),
+		zap.Error(err),
+	)
+	logger.Check(level, "grpc client call "+method).Write(fields...)
+}
@@ -0,0 +1,116 @@
+package grpc_zap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
+)
+
+func dialHealth(t *testing.T, logPayload bool) (healthpb.HealthClient, *observer.ObservedLogs) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("svc", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(logger, logPayload)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor(logger)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return healthpb.NewHealthClient(cc), logs
+}
+
+func checkClientCall(t *testing.T, entry observer.LoggedEntry, code codes.Code) map[string]interface{} {
+	t.Helper()
+	fields := entry.ContextMap()
+	if got := fields["grpc.client.code"]; got != code.String() {
+		t.Errorf("grpc.client.code = %v, want %s", got, code)
+	}
+	if _, ok := fields["grpc.client.latency"]; !ok {
+		t.Error("grpc.client.latency is not logged")
+	}
+	if got := fields["request_id"]; got != "req-1" {
+		t.Errorf("request_id = %v, want req-1", got)
+	}
+	return fields
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	for _, logPayload := range []bool{false, true} {
+		client, logs := dialHealth(t, logPayload)
+		ctx := request_id.InjectRequestID(context.Background(), "req-1")
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "svc"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"}); status.Code(err) != codes.NotFound {
+			t.Fatalf("Check() = %v, want NotFound", err)
+		}
+		entries := logs.All()
+		if len(entries) != 2 {
+			t.Fatalf("logged %d calls, want 2", len(entries))
+		}
+		fields := checkClientCall(t, entries[0], codes.OK)
+		if got := fields["grpc.client.method"]; got != "Check" {
+			t.Errorf("grpc.client.method = %v", got)
+		}
+		_, request := fields["grpc.client.request"]
+		_, response := fields["grpc.client.response"]
+		if request != logPayload || response != logPayload {
+			t.Errorf("logPayload %v: request logged %v, response logged %v", logPayload, request, response)
+		}
+		fields = checkClientCall(t, entries[1], codes.NotFound)
+		if _, ok := fields["grpc.client.response"]; ok {
+			t.Error("response of a failed call is logged")
+		}
+	}
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	client, logs := dialHealth(t, true)
+	ctx, cancel := context.WithCancel(request_id.InjectRequestID(context.Background(), "req-1"))
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "svc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.Len(); n != 0 {
+		t.Errorf("logged %d calls before the stream ended", n)
+	}
+	cancel()
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d calls, want 1", len(entries))
+	}
+	fields := checkClientCall(t, entries[0], codes.Canceled)
+	if _, ok := fields["grpc.client.request"]; ok {
+		t.Error("payload of a stream is logged")
+	}
+}
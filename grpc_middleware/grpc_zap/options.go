@@ -0,0 +1,97 @@
+package grpc_zap
+
+import (
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/redact"
+)
+
+type options struct {
+	redactor       *redact.Redactor
+	sampler        *logfilter.Sampler
+	slow           *logfilter.SlowDetector
+	codeToLevel    CodeToLevel
+	levels         *logfilter.Levels
+	headers        []string
+	headerDenyList []string
+	customHeaders  bool
+	headerFilter   *redact.HeaderFilter
+}
+
+// Option configures the logging interceptors.
+type Option func(o *options)
+
+// WithRedactor sets the redactor of the logged payloads, redact.Default() by
+// default, nil logs payloads as is but still masks the metadata of
+// WithHeaderDenyList.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// WithSampler samples the logged calls by their full method names, see
+// logfilter.Sampler.
+func WithSampler(s *logfilter.Sampler) Option {
+	return func(o *options) {
+		o.sampler = s
+	}
+}
+
+// WithSlowDetector logs the calls slower than their threshold at warn with
+// the timing breakdown, see timing.Track, even if they are not decided to be
+// logged or sampled out.
+func WithSlowDetector(d *logfilter.SlowDetector) Option {
+	return func(o *options) {
+		o.slow = d
+	}
+}
+
+// WithCodeToLevel sets the log levels of codes, DefaultCodeToLevel by default.
+func WithCodeToLevel(f CodeToLevel) Option {
+	return func(o *options) {
+		o.codeToLevel = f
+	}
+}
+
+// WithLevels overrides the log levels of successful calls by their full
+// method names, see logfilter.Levels.
+func WithLevels(l *logfilter.Levels) Option {
+	return func(o *options) {
+		o.levels = l
+	}
+}
+
+// WithHeaders logs only the given metadata, the headers of the redactor
+// are logged by default.
+func WithHeaders(names ...string) Option {
+	return func(o *options) {
+		o.headers = names
+		o.customHeaders = true
+	}
+}
+
+// WithHeaderDenyList masks the values of the given metadata,
+// redact.DefaultHeaderDenyList by default.
+func WithHeaderDenyList(names ...string) Option {
+	return func(o *options) {
+		o.headerDenyList = names
+		o.customHeaders = true
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		redactor:       redact.Default(),
+		codeToLevel:    DefaultCodeToLevel,
+		headerDenyList: redact.DefaultHeaderDenyList,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.headerFilter = o.redactor.HeaderFilter()
+	if o.customHeaders || o.headerFilter == nil {
+		// headers are masked even if bodies are logged as is
+		o.headerFilter = redact.NewHeaderFilter(o.headers, o.headerDenyList, o.redactor.Mask())
+	}
+	return o
+}
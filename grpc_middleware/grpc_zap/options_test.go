@@ -0,0 +1,29 @@
+package grpc_zap
+
+import (
+	"testing"
+
+	"pkg.lucas.icu/micro/redact"
+)
+
+func TestHeaderFilter(t *testing.T) {
+	cfg := redact.DefaultConfig
+	cfg.Mask = "***"
+	r, err := redact.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := map[string][]string{"authorization": {"Bearer token"}, "x-trace": {"1"}}
+	for name, c := range map[string]struct {
+		opts []Option
+		want string
+	}{
+		"nil redactor":   {[]Option{WithRedactor(nil)}, redact.DefaultConfig.Mask},
+		"custom headers": {[]Option{WithRedactor(r), WithHeaders("authorization")}, "***"},
+	} {
+		got := newOptions(c.opts).headerFilter.Filter(md)
+		if v := got["authorization"]; len(v) != 1 || v[0] != c.want {
+			t.Errorf("%s: authorization = %v, want %s", name, v, c.want)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"path"
 	"time"
 
-	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/lixin9311/zapx"
@@ -13,19 +12,28 @@ import (
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/redact"
+	"pkg.lucas.icu/micro/timing"
 )
 
 type LoggingDecider func(ctx context.Context, fullMethodName string) bool
 
-func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDecider) grpc.UnaryServerInterceptor {
+func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDecider, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		if !decider(ctx, info.FullMethod) {
+		// undecided calls are still logged when slow
+		decided := decider(ctx, info.FullMethod)
+		threshold := o.slow.Threshold(info.FullMethod)
+		if !decided && threshold == 0 {
 			return handler(ctx, req)
 		}
+		logReq := logReq && decided
 
 		// populate basic fields
 		fullMethodString := info.FullMethod
@@ -35,7 +43,10 @@ func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDeci
 			zap.String("grpc.service", service),
 			zap.String("grpc.method", method),
 			zapx.Context(ctx),
-			zapx.Metadata(ctx),
+			propagation_module.Field(ctx),
+		}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			f1 = append(f1, zap.Object("metadata", o.headerFilter.Object(md)))
 		}
 		if d, ok := ctx.Deadline(); ok {
 			f1 = append(f1, zap.Time("grpc.request.deadline", d))
@@ -44,7 +55,7 @@ func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDeci
 		// append request
 		if logReq {
 			if pb, ok := req.(proto.Message); ok {
-				f1 = append(f1, zap.Reflect("grpc.request", &jsonpbObjectMarshaler{pb: pb}))
+				f1 = append(f1, zap.Reflect("grpc.request", &jsonpbObjectMarshaler{pb: pb, redactor: o.redactor}))
 			}
 		}
 
@@ -52,14 +63,22 @@ func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDeci
 		callLog := logger.Named(service + "." + method).With(f1...)
 		startTime := time.Now()
 		newCtx := ctxzap.ToContext(ctx, callLog)
+		var timer *timing.Timer
+		if threshold > 0 {
+			newCtx, timer = timing.NewContext(newCtx)
+		}
 
 		// call handler
 		resp, err = handler(newCtx, req)
 
 		// populate response
 		code := status.Code(err)
-		level := codeToLevel(code)
+		level := o.levels.Apply(o.codeToLevel(code), code == codes.OK, info.FullMethod)
 		duration := time.Since(startTime)
+		slow := logfilter.Observe("grpc", info.FullMethod, threshold, duration)
+		if !slow && (!decided || !o.sampler.Sample(code != codes.OK, duration, info.FullMethod)) {
+			return resp, err
+		}
 		status := runtime.HTTPStatusFromCode(code)
 
 		request := zapx.HTTPRequestEntry{
@@ -80,8 +99,18 @@ func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDeci
 		// append request
 		if logReq {
 			if pb, ok := resp.(proto.Message); ok {
-				f2 = append(f2, zap.Reflect("grpc.response", &jsonpbObjectMarshaler{pb: pb}))
+				f2 = append(f2, zap.Reflect("grpc.response", &jsonpbObjectMarshaler{pb: pb, redactor: o.redactor}))
+			}
+		}
+
+		if slow {
+			if level < zapcore.WarnLevel {
+				level = zapcore.WarnLevel
 			}
+			f2 = append(f2,
+				zap.Duration("slow_threshold", threshold),
+				zap.Object("timing", timer),
+			)
 		}
 
 		ctxzap.Extract(newCtx).Check(level, code.String()).Write(f2...)
@@ -90,8 +119,11 @@ func UnaryServerInterceptor(logger *zap.Logger, logReq bool, decider LoggingDeci
 	}
 }
 
-// codeToLevel is the default implementation of gRPC return codes and interceptor log level for server side.
-func codeToLevel(code codes.Code) zapcore.Level {
+// CodeToLevel maps the code of a call to its log level.
+type CodeToLevel func(code codes.Code) zapcore.Level
+
+// DefaultCodeToLevel is the default implementation of gRPC return codes and interceptor log level for server side.
+func DefaultCodeToLevel(code codes.Code) zapcore.Level {
 	switch code {
 	case codes.OK:
 		return zap.InfoLevel
@@ -132,14 +164,35 @@ func codeToLevel(code codes.Code) zapcore.Level {
 	}
 }
 
-func PayloadUnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
-	return grpc_zap.PayloadUnaryServerInterceptor(logger, func(context.Context, string, interface{}) bool { return true })
+// PayloadUnaryServerInterceptor returns a new unary server interceptor that
+// logs the request and response payloads of all calls, masked by the
+// redactor of opts, see WithRedactor.
+func PayloadUnaryServerInterceptor(logger *zap.Logger, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		callLog := logger.With(
+			zap.String("grpc.service", path.Dir(info.FullMethod)[1:]),
+			zap.String("grpc.method", path.Base(info.FullMethod)),
+			zapx.Context(ctx),
+		)
+		if pb, ok := req.(proto.Message); ok {
+			callLog.Info("server request payload logged as grpc.request.content field",
+				zap.Reflect("grpc.request.content", &jsonpbObjectMarshaler{pb: pb, redactor: o.redactor}))
+		}
+		resp, err := handler(ctx, req)
+		if pb, ok := resp.(proto.Message); ok && err == nil {
+			callLog.Info("server response payload logged as grpc.response.content field",
+				zap.Reflect("grpc.response.content", &jsonpbObjectMarshaler{pb: pb, redactor: o.redactor}))
+		}
+		return resp, err
+	}
 }
 
 type jsonpbObjectMarshaler struct {
-	pb proto.Message
+	pb       proto.Message
+	redactor *redact.Redactor
 }
 
 func (j *jsonpbObjectMarshaler) MarshalJSON() ([]byte, error) {
-	return protojson.Marshal(j.pb)
+	return j.redactor.Proto(j.pb)
 }
@@ -0,0 +1,39 @@
+package grpc_zap
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+func TestPayloadUnaryServerInterceptor(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	interceptor := PayloadUnaryServerInterceptor(zap.New(core))
+	req := errorpb.New(codes.NotFound).WithMessage("no user a@example.com")
+	_, err := interceptor(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+		func(context.Context, interface{}) (interface{}, error) { return req, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d payloads, want 2", len(entries))
+	}
+	for i, key := range []string{"grpc.request.content", "grpc.response.content"} {
+		b, err := json.Marshal(entries[i].ContextMap()[key])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); strings.Contains(s, "a@example.com") || !strings.Contains(s, "[REDACTED]") {
+			t.Errorf("%s = %s, want the email masked", key, s)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package request_id
 
 import (
 	"context"
+	"regexp"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/segmentio/ksuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/grpclog"
@@ -11,6 +13,8 @@ import (
 )
 
 const (
+	// RequestIDMetadataKey is the incoming metadata key of the request ID
+	// in context, whatever the header carrying it.
 	RequestIDMetadataKey = "x-request-id"
 )
 
@@ -18,6 +22,113 @@ func init() {
 	ksuid.SetRand(ksuid.FastRander)
 }
 
+// Config configures the request IDs of inbound requests.
+type Config struct {
+	Header    string `mapstructure:"header" validate:"required" desc:"header or metadata carrying request IDs, also returned in responses"`
+	Generator string `mapstructure:"generator" validate:"oneof=ksuid uuid" desc:"generator of missing or invalid request IDs"`
+	MaxLength int    `mapstructure:"max-length" validate:"gt=0" desc:"inbound request IDs longer than this, or with characters other than [A-Za-z0-9._:-], are replaced"`
+}
+
+var DefaultConfig = Config{
+	Header:    RequestIDMetadataKey,
+	Generator: "ksuid",
+	MaxLength: 128,
+}
+
+// Options returns the options of cfg.
+func (cfg Config) Options() []Option {
+	generate := KSUID
+	if cfg.Generator == "uuid" {
+		generate = UUID
+	}
+	return []Option{
+		WithHeader(cfg.Header),
+		WithGenerator(generate),
+		WithValidator(Validator(cfg.MaxLength)),
+	}
+}
+
+type Option func(ids *IDs)
+
+// WithHeader sets the header or metadata carrying request IDs, x-request-id by default.
+func WithHeader(name string) Option {
+	return func(ids *IDs) {
+		ids.header = name
+	}
+}
+
+// WithGenerator sets the generator of request IDs, KSUID by default.
+func WithGenerator(f func() string) Option {
+	return func(ids *IDs) {
+		ids.generate = f
+	}
+}
+
+// WithValidator sets the validator of inbound request IDs, invalid IDs are
+// replaced by generated ones. Validator(128) by default.
+func WithValidator(f func(id string) bool) Option {
+	return func(ids *IDs) {
+		ids.valid = f
+	}
+}
+
+// IDs resolves the request IDs of inbound requests.
+type IDs struct {
+	header   string
+	generate func() string
+	valid    func(id string) bool
+}
+
+func New(opts ...Option) *IDs {
+	ids := &IDs{
+		header:   DefaultConfig.Header,
+		generate: KSUID,
+		valid:    Validator(DefaultConfig.MaxLength),
+	}
+	for _, opt := range opts {
+		opt(ids)
+	}
+	return ids
+}
+
+// Header returns the header or metadata carrying request IDs.
+func (ids *IDs) Header() string {
+	return ids.header
+}
+
+// Resolve returns id if it is valid, otherwise a generated one.
+func (ids *IDs) Resolve(id string) string {
+	if id != "" && ids.valid(id) {
+		return id
+	}
+	return ids.generate()
+}
+
+var idChars = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// Validator returns a validator that accepts IDs of at most maxLength
+// characters of [A-Za-z0-9._:-].
+func Validator(maxLength int) func(id string) bool {
+	return func(id string) bool {
+		return len(id) <= maxLength && idChars.MatchString(id)
+	}
+}
+
+// KSUID generates a ksuid request ID.
+func KSUID() string {
+	if id, err := ksuid.NewRandom(); err != nil {
+		grpclog.Errorf("RequestIDInterceptor: failed to generate random request id, %v", err)
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	} else {
+		return id.String()
+	}
+}
+
+// UUID generates a random UUID request ID.
+func UUID() string {
+	return uuid.NewString()
+}
+
 func ExtractRequestID(ctx context.Context) string {
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
 		reqIDs, ok := md[RequestIDMetadataKey]
@@ -33,42 +144,79 @@ func InjectRequestID(ctx context.Context, id string) context.Context {
 	if !ok {
 		md = metadata.MD{}
 	}
-	md[RequestIDMetadataKey] = []string{id}
-	return metadata.NewIncomingContext(ctx, metadata.Join(md, metadata.Pairs(RequestIDMetadataKey, id)))
+	md.Set(RequestIDMetadataKey, id)
+	return metadata.NewIncomingContext(ctx, md)
 }
 
-func generateRequestID() string {
-	if id, err := ksuid.NewRandom(); err != nil {
-		grpclog.Errorf("RequestIDInterceptor: failed to generate random request id, %v", err)
-		return time.Now().UTC().Format(time.RFC3339Nano)
-	} else {
-		return id.String()
+// incoming resolves the request ID of an inbound call and injects it into ctx.
+func (ids *IDs) incoming(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(ids.header); len(v) > 0 {
+			id = v[0]
+		}
 	}
+	id = ids.Resolve(id)
+	return InjectRequestID(ctx, id), id
 }
 
-func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+// outgoing adds the request ID of ctx, or a generated one, to an outbound call.
+func (ids *IDs) outgoing(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(ids.header)) > 0 {
+		return ctx
+	}
+	id := ExtractRequestID(ctx)
+	if id == "" {
+		id = ids.generate()
+	}
+	return metadata.AppendToOutgoingContext(ctx, ids.header, id)
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor that
+// resolves the request ID of calls and returns it in the response header.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	ids := New(opts...)
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			md = metadata.MD{}
-		}
-		reqID := ExtractRequestID(ctx)
-		if reqID == "" {
-			reqID = generateRequestID()
-		}
-		ctx = metadata.NewIncomingContext(ctx, metadata.Join(md, metadata.Pairs(RequestIDMetadataKey, reqID)))
+		ctx, id := ids.incoming(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(ids.header, id))
 		return handler(ctx, req)
 	}
 }
 
-func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+// StreamServerInterceptor returns a new streaming server interceptor, see
+// UnaryServerInterceptor.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	ids := New(opts...)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := ids.incoming(stream.Context())
+		_ = stream.SetHeader(metadata.Pairs(ids.header, id))
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryClientInterceptor returns a new unary client interceptor that
+// propagates the request ID of the inbound request to outbound calls.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	ids := New(opts...)
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		reqID := ExtractRequestID(ctx)
-		if reqID == "" {
-			reqID = generateRequestID()
-		}
-		md, _ := metadata.FromOutgoingContext(ctx)
-		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(md, metadata.Pairs(RequestIDMetadataKey, reqID)))
-		return invoker(ctx, method, req, reply, cc, opts...)
+		return invoker(ids.outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a new streaming client interceptor, see
+// UnaryClientInterceptor.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	ids := New(opts...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(ids.outgoing(ctx), desc, cc, method, opts...)
 	}
 }
@@ -1,9 +1,11 @@
 package request_id
 
 import (
+	"context"
 	"testing"
 
 	"github.com/segmentio/ksuid"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestRequestID(t *testing.T) {
@@ -11,3 +13,33 @@ func TestRequestID(t *testing.T) {
 
 	t.Logf("generated id: %s", id)
 }
+
+func TestResolve(t *testing.T) {
+	ids := New(WithGenerator(func() string { return "generated" }), WithValidator(Validator(8)))
+	tests := map[string]string{
+		"":            "generated",
+		"abc-1.2:3":   "generated", // too long
+		"abc-1":       "abc-1",
+		"a b":         "generated",
+		"<script>":    "generated",
+		"0123456789a": "generated",
+	}
+	for in, want := range tests {
+		if got := ids.Resolve(in); got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIncoming(t *testing.T) {
+	ids := New(WithHeader("x-correlation-id"))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", "abc", RequestIDMetadataKey, "spoofed"))
+	ctx, id := ids.incoming(ctx)
+	if id != "abc" || ExtractRequestID(ctx) != "abc" {
+		t.Errorf("got request id %q in context %q, want abc", id, ExtractRequestID(ctx))
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if n := len(md.Get(RequestIDMetadataKey)); n != 1 {
+		t.Errorf("got %d request ids in metadata, want 1", n)
+	}
+}
@@ -12,30 +12,102 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"pkg.lucas.icu/micro/alert_module"
 	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/errorpb"
+	grpc_errors "pkg.lucas.icu/micro/grpc_middleware/grpc_errors"
 	grpc_validator "pkg.lucas.icu/micro/grpc_middleware/grpc_validator"
 	grpc_zap "pkg.lucas.icu/micro/grpc_middleware/grpc_zap"
 	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
 	"pkg.lucas.icu/micro/http_module"
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/redact"
 	"pkg.lucas.icu/micro/svc_module"
+	"pkg.lucas.icu/micro/tenant_module"
 	"pkg.lucas.icu/micro/trace_module"
 	"pkg.lucas.icu/micro/utils"
+	"pkg.lucas.icu/micro/viperutil"
 )
 
 type Config struct {
 	ListenAddr       string   `mapstructure:"listen-addr" validate:"required,ip"`
-	ListenPort       int      `mapstructure:"listen-port" validate:"required,gt=0,lte=65535"`
-	LogAllRequest    bool     `mapstructure:"log-all-request"`
-	LogIgnoreMethods []string `mapstructure:"log-ignore-methods"`
+	ListenPort       int      `mapstructure:"listen-port" validate:"required,gt=0,lte=65535" desc:"overridden by PORT when SERVICE_TYPE is grpc"`
+	LogAllRequest    bool     `mapstructure:"log-all-request" desc:"log request and response payloads"`
+	LogIgnoreMethods []string `mapstructure:"log-ignore-methods" desc:"patterns of full method names excluded from request logs, e.g. /grpc.health.v1.Health/* or re:Watch$"`
+
+	LogSampling []logfilter.Rule     `mapstructure:"log-sampling" validate:"dive" desc:"sample the logs of successful calls by full method name"`
+	LogSlow     []logfilter.SlowRule `mapstructure:"log-slow" validate:"dive" desc:"log calls slower than the latency of their method at warn, also ignored ones"`
+	LogLevels   LogLevelConfig       `mapstructure:"log-levels"`
+
+	LogClientCalls    bool `mapstructure:"log-client-calls" desc:"log the calls of clients created by Dial"`
+	LogClientPayloads bool `mapstructure:"log-client-payloads" desc:"log the request and response payloads of client calls"`
+
+	RequestID          request_id.Config        `mapstructure:"request-id"`
+	ResponseValidation ResponseValidationConfig `mapstructure:"response-validation"`
+	ErrorRedaction     errorpb.RedactionConfig  `mapstructure:"error-redaction"`
+}
+
+// ResponseValidationConfig validates the responses of the server and of
+// the clients created by Dial against their proto contract, for debugging
+// and staging.
+type ResponseValidationConfig struct {
+	Enabled bool     `mapstructure:"enabled" desc:"validate responses of the server and of clients created by Dial"`
+	Fail    bool     `mapstructure:"fail" desc:"fail with Internal instead of logging invalid responses"`
+	Methods []string `mapstructure:"methods" desc:"full method names to validate, all methods when empty"`
+}
+
+func (cfg ResponseValidationConfig) options() []grpc_validator.ResponseOption {
+	return []grpc_validator.ResponseOption{
+		grpc_validator.WithResponseAll(true),
+		grpc_validator.WithResponseFail(cfg.Fail),
+		grpc_validator.WithResponseMethods(cfg.Methods...),
+	}
+}
+
+// LogLevelConfig overrides the log levels of calls.
+type LogLevelConfig struct {
+	Codes   map[string]string     `mapstructure:"codes" desc:"log levels of grpc codes overriding the defaults, e.g. not_found: warn"`
+	Methods []logfilter.LevelRule `mapstructure:"methods" validate:"dive" desc:"log levels of successful calls by full method name"`
+}
+
+func (cfg LogLevelConfig) options() ([]grpc_zap.Option, error) {
+	levels := map[codes.Code]zapcore.Level{}
+	for name, level := range cfg.Codes {
+		c, err := errorpb.ParseCode(name)
+		if err != nil {
+			return nil, err
+		}
+		if levels[c], err = logfilter.ParseLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	methods, err := logfilter.NewLevels(cfg.Methods)
+	if err != nil {
+		return nil, err
+	}
+	return []grpc_zap.Option{
+		grpc_zap.WithCodeToLevel(func(c codes.Code) zapcore.Level {
+			if level, ok := levels[c]; ok {
+				return level
+			}
+			return grpc_zap.DefaultCodeToLevel(c)
+		}),
+		grpc_zap.WithLevels(methods),
+	}, nil
 }
 
 var DefaultConfig = wrappedCfg{
 	Grpc: Config{
-		ListenAddr:    "0.0.0.0",
-		ListenPort:    4000,
-		LogAllRequest: true,
+		ListenAddr:     "0.0.0.0",
+		ListenPort:     4000,
+		LogAllRequest:  true,
+		RequestID:      request_id.DefaultConfig,
+		ErrorRedaction: errorpb.DefaultRedactionConfig,
 	},
 }
 
@@ -45,7 +117,7 @@ type wrappedCfg struct {
 
 func ReadConfig(v *viper.Viper) (Config, error) {
 	cfg := &wrappedCfg{}
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
 		return Config{}, err
 	}
 	cfg.Grpc.ListenPort = utils.GetDefaultPort("grpc", cfg.Grpc.ListenPort)
@@ -62,6 +134,7 @@ func Module() fx.Option {
 		fx.Provide(
 			ReadConfig,
 			NewGRPCServer,
+			NewDialer,
 		),
 		// trace_module.WithOpencensusViews(
 		// 	ocgrpc.DefaultServerViews...,
@@ -76,9 +149,6 @@ func Module() fx.Option {
 		// 	ocgrpc.ClientReceivedMessagesPerRPCView,
 		// 	ocgrpc.ClientServerLatencyView,
 		// ),
-		fx.Invoke(
-			CheckConfig,
-		),
 	)
 }
 
@@ -103,27 +173,77 @@ type grpcServerOptionsParams struct {
 type optionalParams struct {
 	fx.In
 
-	ValidatorOptions []grpc_validator.Option `optional:"true"`
-	RecoveryOptions  []grpc_recovery.Option  `optional:"true"`
-	TraceCfg         trace_module.Config     `optional:"true"`
+	ValidatorOptions []grpc_validator.Option        `optional:"true"`
+	RecoveryOptions  []grpc_recovery.Option         `optional:"true"`
+	TraceCfg         trace_module.Config            `optional:"true"`
+	Monitor          *alert_module.Monitor          `optional:"true"`
+	Redactor         *redact.Redactor               `optional:"true"`
+	Propagator       *propagation_module.Propagator `optional:"true"`
+	Tenancy          *tenant_module.Tenancy         `optional:"true"`
 }
 
-func NewGRPCServer(lc fx.Lifecycle, cfg Config, svcCfg svc_module.OptionalConfig, svOpts grpcServerOptionsParams, logger *zap.Logger, ocfg optionalParams) (*grpc.Server, http_module.HttpOptions) {
-	ignoredMethods := map[string]bool{}
-	for _, m := range cfg.LogIgnoreMethods {
-		ignoredMethods[m] = true
+func NewGRPCServer(lc fx.Lifecycle, cfg Config, svcCfg svc_module.OptionalConfig, svOpts grpcServerOptionsParams, logger *zap.Logger, ocfg optionalParams) (*grpc.Server, http_module.HttpOptions, error) {
+	if err := errorpb.CheckRegistry(); err != nil {
+		return nil, http_module.HttpOptions{}, err
+	}
+	redactor, err := errorpb.NewRedactor(cfg.ErrorRedaction)
+	if err != nil {
+		return nil, http_module.HttpOptions{}, fmt.Errorf("invalid grpc.error-redaction: %w", err)
+	}
+	ignoredMethods, err := logfilter.NewMatcher(cfg.LogIgnoreMethods...)
+	if err != nil {
+		return nil, http_module.HttpOptions{}, fmt.Errorf("invalid grpc.log-ignore-methods: %w", err)
+	}
+	sampler, err := logfilter.NewSampler(cfg.LogSampling)
+	if err != nil {
+		return nil, http_module.HttpOptions{}, fmt.Errorf("invalid grpc.log-sampling: %w", err)
+	}
+	slow, err := logfilter.NewSlowDetector(cfg.LogSlow)
+	if err != nil {
+		return nil, http_module.HttpOptions{}, fmt.Errorf("invalid grpc.log-slow: %w", err)
+	}
+	logOpts, err := cfg.LogLevels.options()
+	if err != nil {
+		return nil, http_module.HttpOptions{}, fmt.Errorf("invalid grpc.log-levels: %w", err)
+	}
+	logOpts = append(logOpts, grpc_zap.WithSampler(sampler), grpc_zap.WithSlowDetector(slow))
+	if ocfg.Redactor != nil {
+		logOpts = append(logOpts, grpc_zap.WithRedactor(ocfg.Redactor))
 	}
 	ints := []grpc.UnaryServerInterceptor{
 		// insert request id
-		request_id.UnaryServerInterceptor(),
+		request_id.UnaryServerInterceptor(cfg.RequestID.Options()...),
+		// read propagated values, e.g. tenant ID, before they are logged
+		propagation_module.UnaryServerInterceptor(ocfg.Propagator),
+		tenant_module.ResolveUnaryServerInterceptor(ocfg.Tenancy),
+		// redact errors leaving the process, logs keep the full errors
+		grpc_errors.UnaryServerInterceptor(redactor),
+		// count errors by ID and fire alerts
+		alert_module.UnaryServerInterceptor(ocfg.Monitor),
 		grpc_recovery.UnaryServerInterceptor(ocfg.RecoveryOptions...),
-		grpc_zap.UnaryServerInterceptor(logger, cfg.LogAllRequest, func(_ context.Context, m string) bool { return ignoredMethods[m] }),
+		grpc_zap.UnaryServerInterceptor(logger, cfg.LogAllRequest, func(_ context.Context, m string) bool { return !ignoredMethods.Match(m) }, logOpts...),
+		// reject calls without tenant in strict mode or over rate limits, after they are logged
+		tenant_module.UnaryServerInterceptor(ocfg.Tenancy),
 		grpc_validator.UnaryServerInterceptor(ocfg.ValidatorOptions...),
 		grpc_prometheus.UnaryServerInterceptor,
 	}
 
+	streamInts := []grpc.StreamServerInterceptor{
+		request_id.StreamServerInterceptor(cfg.RequestID.Options()...),
+		propagation_module.StreamServerInterceptor(ocfg.Propagator),
+		grpc_errors.StreamServerInterceptor(redactor),
+		alert_module.StreamServerInterceptor(ocfg.Monitor),
+		// inside grpc_errors and alert_module, like the unary check
+		tenant_module.StreamServerInterceptor(ocfg.Tenancy),
+	}
+	if rv := cfg.ResponseValidation; rv.Enabled {
+		ints = append(ints, grpc_validator.ResponseUnaryServerInterceptor(rv.options()...))
+		streamInts = append(streamInts, grpc_validator.ResponseStreamServerInterceptor(rv.options()...))
+	}
+
 	options := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(ints...),
+		grpc.ChainStreamInterceptor(streamInts...),
 	}
 
 	if ocfg.TraceCfg.Fraction > 0 && ocfg.TraceCfg.Driver != "none" && ocfg.TraceCfg.Driver != "" {
@@ -167,32 +287,107 @@ func NewGRPCServer(lc fx.Lifecycle, cfg Config, svcCfg svc_module.OptionalConfig
 	})
 
 	// init grpc before http module
-	return srv, http_module.BeforeHttp()
+	return srv, http_module.BeforeHttp(), nil
 }
 
-func MustDial(addr string, opts ...grpc.DialOption) *grpc.ClientConn {
-	c, err := Dial(
-		addr,
-		opts...,
-	)
-	if err != nil {
-		panic(err)
+// Dialer creates clients with the request ID, propagation, logging and
+// response validation options of the config, it is provided by Module.
+// A nil Dialer creates clients like Dial.
+type Dialer struct {
+	requestID  []request_id.Option
+	propagator *propagation_module.Propagator
+	opts       []grpc.DialOption
+}
+
+type dialParams struct {
+	fx.In
+
+	Redactor   *redact.Redactor               `optional:"true"`
+	Propagator *propagation_module.Propagator `optional:"true"`
+}
+
+// NewDialer returns the Dialer of cfg.
+func NewDialer(cfg Config, logger *zap.Logger, params dialParams) (*Dialer, error) {
+	d := &Dialer{
+		requestID:  cfg.RequestID.Options(),
+		propagator: params.Propagator,
 	}
-	return c
+	if cfg.LogClientCalls {
+		logOpts, err := cfg.LogLevels.options()
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc.log-levels: %w", err)
+		}
+		if params.Redactor != nil {
+			logOpts = append(logOpts, grpc_zap.WithRedactor(params.Redactor))
+		}
+		d.opts = append(d.opts,
+			grpc.WithChainUnaryInterceptor(grpc_zap.UnaryClientInterceptor(logger, cfg.LogClientPayloads, logOpts...)),
+			grpc.WithChainStreamInterceptor(grpc_zap.StreamClientInterceptor(logger, logOpts...)),
+		)
+	}
+	if rv := cfg.ResponseValidation; rv.Enabled {
+		rvOpts := append(rv.options(), grpc_validator.WithResponseLogger(logger))
+		d.opts = append(d.opts,
+			grpc.WithChainUnaryInterceptor(grpc_validator.ResponseUnaryClientInterceptor(rvOpts...)),
+			grpc.WithChainStreamInterceptor(grpc_validator.ResponseStreamClientInterceptor(rvOpts...)),
+		)
+	}
+	return d, nil
 }
 
-func Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	newOpts := make([]grpc.DialOption, 0, len(opts)+1)
+// Dial creates a client of addr with the metrics, tracing, request ID,
+// propagation and tenant interceptors, and the options of d.
+func (d *Dialer) Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	var (
+		requestID  []request_id.Option
+		propagator *propagation_module.Propagator
+		dialOpts   []grpc.DialOption
+	)
+	if d != nil {
+		requestID, propagator, dialOpts = d.requestID, d.propagator, d.opts
+	}
+	newOpts := make([]grpc.DialOption, 0, len(opts)+len(dialOpts)+3)
 	newOpts = append(newOpts,
 		grpc.WithChainUnaryInterceptor(
-			request_id.UnaryClientInterceptor(),
+			request_id.UnaryClientInterceptor(requestID...),
+			propagation_module.UnaryClientInterceptor(propagator),
+			tenant_module.UnaryClientInterceptor(),
 			grpc_prometheus.UnaryClientInterceptor,
 		),
+		grpc.WithChainStreamInterceptor(
+			request_id.StreamClientInterceptor(requestID...),
+			propagation_module.StreamClientInterceptor(propagator),
+			tenant_module.StreamClientInterceptor(),
+		),
 		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	)
+	newOpts = append(newOpts, dialOpts...)
 	newOpts = append(newOpts, opts...)
 	return grpc.Dial(
 		addr,
 		newOpts...,
 	)
 }
+
+// MustDial is like Dial but panics on error.
+func (d *Dialer) MustDial(addr string, opts ...grpc.DialOption) *grpc.ClientConn {
+	c, err := d.Dial(
+		addr,
+		opts...,
+	)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func MustDial(addr string, opts ...grpc.DialOption) *grpc.ClientConn {
+	return (*Dialer)(nil).MustDial(addr, opts...)
+}
+
+// Dial creates a client of addr with the metrics, tracing, request ID and
+// tenant interceptors and the default request ID options. Use the Dialer
+// provided by Module for the options of the config.
+func Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return (*Dialer)(nil).Dial(addr, opts...)
+}
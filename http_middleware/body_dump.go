@@ -0,0 +1,80 @@
+package http_middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+)
+
+const truncatedSuffix = "...[truncated]"
+
+// bodyDumpResponseWriter keeps at most max bytes of the response body for
+// logging. Streamed responses, which are flushed or hijacked, are not kept.
+type bodyDumpResponseWriter struct {
+	http.ResponseWriter
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+	streamed  bool
+}
+
+func (w *bodyDumpResponseWriter) Write(b []byte) (int, error) {
+	if !w.streamed {
+		keep := b
+		if w.max > 0 {
+			if room := w.max - w.buf.Len(); len(keep) > room {
+				keep = keep[:room]
+				w.truncated = true
+			}
+		}
+		w.buf.Write(keep)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyDumpResponseWriter) Flush() {
+	w.stream()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *bodyDumpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.stream()
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+func (w *bodyDumpResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *bodyDumpResponseWriter) stream() {
+	w.streamed = true
+	w.buf = bytes.Buffer{}
+}
+
+// loggable reports whether the body is kept and of the allowed content types,
+// which are glob patterns like `text/*`. Event streams are never logged.
+func (w *bodyDumpResponseWriter) loggable(contentType string, allowed []string) bool {
+	if w.streamed || w.buf.Len() == 0 {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mt == "text/event-stream" {
+		return false
+	}
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, mt); ok {
+			return true
+		}
+	}
+	return false
+}
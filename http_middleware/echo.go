@@ -2,27 +2,24 @@ package http_middleware
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"runtime/debug"
-	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	"github.com/lixin9311/zapx"
-	"github.com/segmentio/ksuid"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"google.golang.org/grpc/metadata"
+	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/timing"
 	"pkg.lucas.icu/micro/version"
 )
 
-func init() {
-	ksuid.SetRand(ksuid.FastRander)
-}
-
 func Echox(service string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -36,39 +33,29 @@ func Echox(service string) echo.MiddlewareFunc {
 	}
 }
 
-func EchoRequestID() echo.MiddlewareFunc {
-	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
-		Generator: func() string {
-			return ksuid.New().String()
-		},
-		RequestIDHandler: func(c echo.Context, rid string) {
-			ctx := c.Request().Context()
-			md, ok := metadata.FromIncomingContext(ctx)
-			if !ok {
-				md = metadata.MD{}
-			}
-			ctx = metadata.NewIncomingContext(ctx, metadata.Join(md, metadata.Pairs("x-request-id", rid)))
-			c.SetRequest(c.Request().Clone(ctx))
-		},
-	})
+// EchoRequestID resolves the request ID of requests, see request_id.IDs,
+// and returns it in the response header.
+func EchoRequestID(opts ...request_id.Option) echo.MiddlewareFunc {
+	ids := request_id.New(opts...)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := ids.Resolve(req.Header.Get(ids.Header()))
+			req.Header.Set(ids.Header(), id)
+			c.Response().Header().Set(ids.Header(), id)
+			c.SetRequest(req.WithContext(request_id.InjectRequestID(req.Context(), id)))
+			return next(c)
+		}
+	}
 }
 
 func WrapMiddleware(m echo.MiddlewareFunc, opts ...LogOption) echo.MiddlewareFunc {
-	o := &options{
-		filters:      []RequestFilter{ExcludeURLs(defaultSkippedURLs...)},
-		headersToLog: []string{"x-request-id"},
-	}
-	for _, opt := range opts {
-		opt(o)
-	}
-	o.filters = append(o.filters, ExcludeURLs(o.skippedURLs...))
+	o := newOptions(opts)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			for _, f := range o.filters {
-				if !f(c.Request().RequestURI) {
-					return next(c)
-				}
+			if o.skipped(c) {
+				return next(c)
 			}
 			return m(next)(c)
 		}
@@ -101,113 +88,63 @@ func recoverFunc(l *zap.Logger, c echo.Context) {
 }
 
 func EchoRequestLogger(logger *zap.Logger, opts ...LogOption) echo.MiddlewareFunc {
-	o := &options{
-		filters:      []RequestFilter{ExcludeURLs(defaultSkippedURLs...)},
-		headersToLog: []string{"x-request-id"},
-	}
-	for _, opt := range opts {
-		opt(o)
-	}
-	o.filters = append(o.filters, ExcludeURLs(o.skippedURLs...))
-
-	if o.logBody {
-		return func(next echo.HandlerFunc) echo.HandlerFunc {
-			return func(c echo.Context) error {
-				defer recoverFunc(logger, c)
-				for _, f := range o.filters {
-					if !f(c.Request().RequestURI) {
-						return next(c)
-					}
-				}
-
-				// Request
-				reqBody := []byte{}
-				if c.Request().Body != nil { // Read
-					reqBody, _ = io.ReadAll(c.Request().Body)
-				}
-				c.Request().Body = io.NopCloser(bytes.NewBuffer(reqBody)) // Reset
-
-				// Response
-				// resBody := new(bytes.Buffer)
-				// mw := io.MultiWriter(c.Response().Writer, resBody)
-				// writer := &bodyDumpResponseWriter{Writer: mw, ResponseWriter: c.Response().Writer}
-				// c.Response().Writer = writer
-
-				start := time.Now()
-				err := next(c)
-				if err != nil {
-					c.Error(err)
-				}
-
-				req := c.Request()
-				ctx := req.Context()
-				res := c.Response()
-
-				l := logger.Info
-
-				if res.Status >= 500 {
-					l = logger.Error
-				} else if res.Status >= 400 {
-					l = logger.Warn
-				}
-
-				id := req.Header.Get(echo.HeaderXRequestID)
-				if id == "" {
-					id = res.Header().Get(echo.HeaderXRequestID)
-				}
+	o := newOptions(opts)
 
-				fields := []zapcore.Field{
-					zapx.Request(zapx.HTTPRequestEntry{
-						Request:      req,
-						Status:       res.Status,
-						ResponseSize: res.Size,
-						Latency:      time.Since(start),
-						RemoteIP:     c.RealIP(),
-					}),
-					zap.String("http.body", sanitized(string(reqBody))),
-					zap.String("request_id", id),
-					zap.Any("http.header", c.Request().Header),
-					zapx.Context(ctx),
-				}
-				if err != nil {
-					fields = append(fields, zap.Error(err))
-				}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			defer recoverFunc(logger, c)
+			// skipped requests are still logged when slow
+			skipped := o.skipped(c)
+			threshold := o.slow.Threshold(c.Request().URL.Path, c.Path())
+			if skipped && threshold == 0 {
+				return next(c)
+			}
+			start := time.Now()
 
-				l(req.URL.Path, fields...)
+			// Request
+			var reqBody []byte
+			logBody := o.logBody && !skipped
+			if logBody && c.Request().Body != nil {
+				reqBody, _ = io.ReadAll(c.Request().Body)
+				c.Request().Body = io.NopCloser(bytes.NewBuffer(reqBody)) // Reset
+			}
 
-				return nil
+			// Response
+			var dump *bodyDumpResponseWriter
+			if o.logResponseBody && !skipped {
+				dump = &bodyDumpResponseWriter{ResponseWriter: c.Response().Writer, max: o.maxBodySize}
+				c.Response().Writer = dump
 			}
-		}
-	}
 
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			defer recoverFunc(logger, c)
-			for _, f := range o.filters {
-				if !f(c.Request().RequestURI) {
-					return next(c)
-				}
+			var timer *timing.Timer
+			if threshold > 0 {
+				var ctx context.Context
+				ctx, timer = timing.NewContext(c.Request().Context())
+				c.SetRequest(c.Request().WithContext(ctx))
+				c.Response().Before(func() {
+					timer.Add("first_byte", time.Since(start))
+				})
 			}
 
-			start := time.Now()
 			err := next(c)
 			if err != nil {
 				c.Error(err)
 			}
 
+			latency := time.Since(start)
 			req := c.Request()
 			ctx := req.Context()
 			res := c.Response()
 
-			l := logger.Info
+			level := o.levels.Apply(o.statusToLevel(res.Status), res.Status/100 == 2, req.URL.Path, c.Path())
 
-			if res.Status >= 500 {
-				l = logger.Error
-			} else if res.Status >= 400 {
-				l = logger.Warn
+			slow := logfilter.Observe("http", c.Path(), threshold, latency)
+			failed := err != nil || res.Status >= 400
+			if !slow && (skipped || !o.sampler.Sample(failed, latency, req.URL.Path, c.Path())) {
+				return nil
 			}
 
-			id := req.Header.Get(echo.HeaderXRequestID)
+			id := request_id.ExtractRequestID(ctx)
 			if id == "" {
 				id = res.Header().Get(echo.HeaderXRequestID)
 			}
@@ -217,35 +154,64 @@ func EchoRequestLogger(logger *zap.Logger, opts ...LogOption) echo.MiddlewareFun
 					Request:      req,
 					Status:       res.Status,
 					ResponseSize: res.Size,
-					Latency:      time.Since(start),
+					Latency:      latency,
 					RemoteIP:     c.RealIP(),
 				}),
-				// zap.String("body", req.)
 				zap.String("request_id", id),
 				zapx.Context(ctx),
+				propagation_module.Field(ctx),
+			}
+			if logBody {
+				fields = append(fields, zap.String("http.body", truncate(o.redactor.Body(reqBody, req.Header.Get(echo.HeaderContentType)), o.maxBodySize)))
+			}
+			if logBody || (o.headerFilter.Selective() && !skipped) {
+				fields = append(fields, zap.Object("http.header", o.headerFilter.Object(req.Header)))
+			}
+			if ct := res.Header().Get(echo.HeaderContentType); dump != nil && dump.loggable(ct, o.bodyContentTypes) {
+				body := o.redactor.Body(dump.buf.Bytes(), ct)
+				if dump.truncated {
+					body += truncatedSuffix
+				}
+				fields = append(fields, zap.String("http.response.body", body))
 			}
 			if err != nil {
 				fields = append(fields, zap.Error(err))
 			}
+			if slow {
+				if level < zapcore.WarnLevel {
+					level = zapcore.WarnLevel
+				}
+				fields = append(fields,
+					zap.Duration("slow_threshold", threshold),
+					zap.Object("timing", timer),
+				)
+			}
 
-			l(req.URL.Path, fields...)
+			logger.Check(level, req.URL.Path).Write(fields...)
 
 			return nil
 		}
 	}
 }
 
-// lines contain one of these words are omitted.
-var sanitizeWords = []string{
-	"password",
-	"credit_card",
+// StatusToLevel maps the HTTP status of a request to its log level.
+type StatusToLevel func(status int) zapcore.Level
+
+// DefaultStatusToLevel logs 5xx at error, 4xx at warn and others at info.
+func DefaultStatusToLevel(status int) zapcore.Level {
+	switch {
+	case status >= 500:
+		return zapcore.ErrorLevel
+	case status >= 400:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.InfoLevel
+	}
 }
 
-func sanitized(s string) string {
-	for _, w := range sanitizeWords {
-		if strings.Contains(s, w) {
-			return "sanitized"
-		}
+func truncate(s string, max int) string {
+	if max > 0 && len(s) > max {
+		return s[:max] + truncatedSuffix
 	}
 	return s
 }
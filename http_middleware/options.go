@@ -1,20 +1,27 @@
 package http_middleware
 
+import (
+	"github.com/labstack/echo/v4"
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/redact"
+)
+
 // LogOption is an option for a request logger.
 type LogOption func(*options)
 
 // RequestFilter returns false if the request should be filtered out and true otherwise
+//
+// Deprecated: the request loggers take no RequestFilter, use SkipURL.
 type RequestFilter func(url string) bool
 
-// ExcludeURLs returns a RequestFilter that only logs requests for URLs in the urls parameter
+// ExcludeURLs returns a RequestFilter that filters out the URLs matching one
+// of the patterns, see logfilter.Matcher. It panics on invalid patterns.
+//
+// Deprecated: use SkipURL.
 func ExcludeURLs(urls ...string) RequestFilter {
+	m := logfilter.MustMatcher(urls...)
 	return func(url string) bool {
-		for _, u := range urls {
-			if url == u {
-				return false
-			}
-		}
-		return true
+		return !m.Match(url)
 	}
 }
 
@@ -24,6 +31,93 @@ func WithLogBody(b bool) LogOption {
 	}
 }
 
+// WithLogResponseBody logs the response bodies of the content types set by
+// WithBodyContentTypes. Streamed responses are never logged.
+func WithLogResponseBody(b bool) LogOption {
+	return func(o *options) {
+		o.logResponseBody = b
+	}
+}
+
+// WithMaxBodySize truncates the logged request and response bodies to n
+// bytes, 0 means no limit.
+func WithMaxBodySize(n int) LogOption {
+	return func(o *options) {
+		o.maxBodySize = n
+	}
+}
+
+// WithBodyContentTypes sets the glob patterns of the content types whose
+// response bodies are logged, e.g. `application/json` or `text/*`.
+func WithBodyContentTypes(patterns ...string) LogOption {
+	return func(o *options) {
+		o.bodyContentTypes = patterns
+	}
+}
+
+// WithRedactor sets the redactor of the logged bodies, redact.Default() by
+// default, nil logs bodies as is but still masks the headers of
+// WithHeaderDenyList.
+func WithRedactor(r *redact.Redactor) LogOption {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// WithSampler samples the logged requests by their path and route template,
+// see logfilter.Sampler.
+func WithSampler(s *logfilter.Sampler) LogOption {
+	return func(o *options) {
+		o.sampler = s
+	}
+}
+
+// WithSlowDetector logs the requests slower than their threshold at warn
+// with the timing breakdown, see timing.Track, even if they are skipped or
+// sampled out.
+func WithSlowDetector(d *logfilter.SlowDetector) LogOption {
+	return func(o *options) {
+		o.slow = d
+	}
+}
+
+// WithStatusToLevel sets the log levels of HTTP statuses,
+// DefaultStatusToLevel by default.
+func WithStatusToLevel(f StatusToLevel) LogOption {
+	return func(o *options) {
+		o.statusToLevel = f
+	}
+}
+
+// WithLevels overrides the log levels of successful requests by their path
+// and route template, see logfilter.Levels.
+func WithLevels(l *logfilter.Levels) LogOption {
+	return func(o *options) {
+		o.levels = l
+	}
+}
+
+// WithHeaders logs only the given request headers, they are logged even if
+// bodies are not. The headers of the redactor are logged by default.
+func WithHeaders(names ...string) LogOption {
+	return func(o *options) {
+		o.headers = names
+		o.customHeaders = true
+	}
+}
+
+// WithHeaderDenyList masks the values of the given request headers,
+// redact.DefaultHeaderDenyList by default.
+func WithHeaderDenyList(names ...string) LogOption {
+	return func(o *options) {
+		o.headerDenyList = names
+		o.customHeaders = true
+	}
+}
+
+// SkipURL skips the requests whose path or route template, e.g.
+// `/users/:id`, matches one of the patterns, see logfilter.Matcher.
+// It panics on invalid patterns.
 func SkipURL(urls ...string) LogOption {
 	return func(o *options) {
 		o.skippedURLs = append(o.skippedURLs, urls...)
@@ -39,9 +133,54 @@ var defaultSkippedURLs = []string{
 	"/",
 }
 
+// DefaultBodyContentTypes are the content types whose response bodies are logged by default.
+var DefaultBodyContentTypes = []string{
+	"application/json",
+	"application/*+json",
+	"text/plain",
+}
+
+// DefaultMaxBodySize is the default limit of the logged bodies.
+const DefaultMaxBodySize = 4096
+
 type options struct {
-	filters      []RequestFilter
-	headersToLog []string
-	logBody      bool
-	skippedURLs  []string
+	skip             *logfilter.Matcher
+	sampler          *logfilter.Sampler
+	slow             *logfilter.SlowDetector
+	statusToLevel    StatusToLevel
+	levels           *logfilter.Levels
+	headers          []string
+	headerDenyList   []string
+	customHeaders    bool
+	headerFilter     *redact.HeaderFilter
+	logBody          bool
+	logResponseBody  bool
+	maxBodySize      int
+	bodyContentTypes []string
+	redactor         *redact.Redactor
+	skippedURLs      []string
+}
+
+func newOptions(opts []LogOption) *options {
+	o := &options{
+		headerDenyList:   redact.DefaultHeaderDenyList,
+		maxBodySize:      DefaultMaxBodySize,
+		bodyContentTypes: DefaultBodyContentTypes,
+		redactor:         redact.Default(),
+		statusToLevel:    DefaultStatusToLevel,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.skip = logfilter.MustMatcher(append(defaultSkippedURLs, o.skippedURLs...)...)
+	o.headerFilter = o.redactor.HeaderFilter()
+	if o.customHeaders || o.headerFilter == nil {
+		// headers are masked even if bodies are logged as is
+		o.headerFilter = redact.NewHeaderFilter(o.headers, o.headerDenyList, o.redactor.Mask())
+	}
+	return o
+}
+
+func (o *options) skipped(c echo.Context) bool {
+	return o.skip.Match(c.Request().URL.Path, c.Path())
 }
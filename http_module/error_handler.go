@@ -0,0 +1,67 @@
+package http_module
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"pkg.lucas.icu/micro/errorpb"
+)
+
+// DefaultErrorMarshaler is the marshaler of error bodies, the same as the
+// default of gateway_module.
+var DefaultErrorMarshaler runtime.Marshaler = &runtime.JSONPb{
+	MarshalOptions: protojson.MarshalOptions{
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+	},
+}
+
+// HTTPErrorHandler renders the errors of plain echo handlers like the
+// errors of gateway routes: any error, including *echo.HTTPError, is
+// converted by errorpb.FromError, with the request ID in metadata.
+// *echo.HTTPError keeps its HTTP status.
+func HTTPErrorHandler(marshaler runtime.Marshaler, opts ...errorpb.GWOption) echo.HTTPErrorHandler {
+	handler := errorpb.NewHTTPErrorHandler(opts...)
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		r := c.Request()
+		var status int
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+			err = fromHTTPError(he)
+		}
+
+		e := errorpb.MustFromError(err)
+		if _, ok := e.Metadata[errorpb.KeyRequestID]; !ok {
+			// errors may be shared, e.g. package level variables
+			e = proto.Clone(e).(*errorpb.Error).WithContext(r.Context())
+			err = e
+		}
+		if status != 0 {
+			err = &runtime.HTTPStatusError{HTTPStatus: status, Err: err}
+		}
+		handler(r.Context(), nil, marshaler, c.Response(), r, err)
+	}
+}
+
+func fromHTTPError(he *echo.HTTPError) error {
+	if he.Internal != nil {
+		// keep the errorpb.Error set by handlers
+		if _, ok := errorpb.FromError(he.Internal); ok {
+			return he.Internal
+		}
+	}
+	msg := http.StatusText(he.Code)
+	if he.Message != nil {
+		msg = fmt.Sprint(he.Message)
+	}
+	return errorpb.New(errorpb.CodeFromHTTPStatus(he.Code)).WithMessage(msg)
+}
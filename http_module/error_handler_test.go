@@ -0,0 +1,62 @@
+package http_module
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/errorpb"
+	"pkg.lucas.icu/micro/http_middleware"
+)
+
+var errShared = errorpb.New(codes.NotFound, "USER_NOT_FOUND").WithMessage("no such user")
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler(DefaultErrorMarshaler)
+	e.Use(http_middleware.EchoRequestID())
+	e.GET("/teapot", func(echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot, "short and stout")
+	})
+	e.GET("/wrapped", func(echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest).SetInternal(errShared)
+	})
+	e.GET("/shared", func(echo.Context) error {
+		return errShared
+	})
+	for _, c := range []struct {
+		path    string
+		status  int
+		id, msg string
+	}{
+		{"/teapot", http.StatusTeapot, "FailedPrecondition", "short and stout"},
+		{"/wrapped", http.StatusBadRequest, "USER_NOT_FOUND", "no such user"},
+		{"/shared", http.StatusNotFound, "USER_NOT_FOUND", "no such user"},
+		{"/missing", http.StatusNotFound, "NotFound", "Not Found"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set("X-Request-Id", "req-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("GET %s = %d, want %d", c.path, rec.Code, c.status)
+		}
+		var body struct {
+			ID       string            `json:"id"`
+			Message  string            `json:"message"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v: %s", c.path, err, rec.Body)
+		}
+		if body.ID != c.id || body.Message != c.msg || body.Metadata[errorpb.KeyRequestID] != "req-1" {
+			t.Errorf("GET %s = %s", c.path, rec.Body)
+		}
+	}
+	if _, ok := errShared.Metadata[errorpb.KeyRequestID]; ok {
+		t.Error("shared error is modified")
+	}
+}
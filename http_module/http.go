@@ -2,9 +2,12 @@ package http_module
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -17,13 +20,22 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/net/http2"
+	"pkg.lucas.icu/micro/alert_module"
 	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/errorpb"
+	request_id "pkg.lucas.icu/micro/grpc_middleware/requestid"
 	"pkg.lucas.icu/micro/http_middleware"
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/redact"
 	"pkg.lucas.icu/micro/svc_module"
+	"pkg.lucas.icu/micro/tenant_module"
 	"pkg.lucas.icu/micro/trace_module"
 	"pkg.lucas.icu/micro/utils"
 	"pkg.lucas.icu/micro/version"
+	"pkg.lucas.icu/micro/viperutil"
 )
 
 type beforeHttp struct{}
@@ -31,8 +43,12 @@ type beforeHttp struct{}
 type optionalParams struct {
 	fx.In
 
-	TraceCfg trace_module.Config `optional:"true"`
-	Before   []beforeHttp        `group:"before_http"`
+	TraceCfg   trace_module.Config            `optional:"true"`
+	Monitor    *alert_module.Monitor          `optional:"true"`
+	Redactor   *redact.Redactor               `optional:"true"`
+	Propagator *propagation_module.Propagator `optional:"true"`
+	Tenancy    *tenant_module.Tenancy         `optional:"true"`
+	Before     []beforeHttp                   `group:"before_http"`
 }
 
 type HttpOptions struct {
@@ -48,12 +64,27 @@ func BeforeHttp() HttpOptions {
 }
 
 type Config struct {
-	ListenAddr     string      `mapstructure:"listen-addr" validate:"required,ip"`
-	ListenPort     int         `mapstructure:"listen-port" validate:"required,gt=0,lte=65535"`
-	LogAllRequest  bool        `mapstructure:"log-all-request"`
-	LogIgnorePaths []string    `mapstructure:"log-ignore-paths"`
-	CORS           CorsSetting `mapstructure:"cors"`
-	H2c            bool        `mapstructure:"h2c"`
+	ListenAddr     string   `mapstructure:"listen-addr" validate:"required,ip"`
+	ListenPort     int      `mapstructure:"listen-port" validate:"required,gt=0,lte=65535" desc:"overridden by PORT when SERVICE_TYPE is http"`
+	LogAllRequest  bool     `mapstructure:"log-all-request" desc:"log request bodies"`
+	LogIgnorePaths []string `mapstructure:"log-ignore-paths" desc:"patterns of paths or route templates excluded from request logs and traces, e.g. /static/** or re:^/debug/"`
+
+	LogSampling []logfilter.Rule     `mapstructure:"log-sampling" validate:"dive" desc:"sample the logs of successful requests by path or route template"`
+	LogSlow     []logfilter.SlowRule `mapstructure:"log-slow" validate:"dive" desc:"log requests slower than the latency of their route at warn, also ignored ones"`
+	LogLevels   LogLevelConfig       `mapstructure:"log-levels"`
+
+	LogResponseBody     bool     `mapstructure:"log-response-body" desc:"log response bodies, streamed responses are skipped"`
+	LogBodyMaxBytes     int      `mapstructure:"log-body-max-bytes" validate:"gte=0" desc:"truncate logged bodies to this size, 0 means no limit"`
+	LogBodyContentTypes []string `mapstructure:"log-body-content-types" desc:"content type patterns of the logged response bodies, e.g. text/*"`
+
+	CORS        CorsSetting `mapstructure:"cors"`
+	H2c         bool        `mapstructure:"h2c" desc:"serve HTTP/2 without TLS, disables body logging"`
+	ConfigPath  string      `mapstructure:"config-path" desc:"serve the effective config with sensitive values redacted at this path, disabled when empty"`
+	ConfigToken string      `mapstructure:"config-token" validate:"required_with=ConfigPath" desc:"bearer token required by config-path, the config shows the topology of the service"`
+	ErrorsPath  string      `mapstructure:"errors-path" desc:"serve the catalog of registered error IDs at this path, disabled when empty"`
+
+	RequestID      request_id.Config       `mapstructure:"request-id"`
+	ErrorRedaction errorpb.RedactionConfig `mapstructure:"error-redaction"`
 }
 
 type CorsSetting struct {
@@ -66,21 +97,93 @@ var DefaultConfig = wrappedCfg{
 		ListenAddr:    "0.0.0.0",
 		ListenPort:    3000,
 		LogAllRequest: true,
+
+		LogBodyMaxBytes:     http_middleware.DefaultMaxBodySize,
+		LogBodyContentTypes: http_middleware.DefaultBodyContentTypes,
+
 		CORS: CorsSetting{
 			AllowOrigins: []string{"*"},
 			AllowHeaders: []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "Authorization", "ResponseType"},
 		},
-		H2c: false,
+		H2c:            false,
+		RequestID:      request_id.DefaultConfig,
+		ErrorRedaction: errorpb.DefaultRedactionConfig,
 	},
 }
 
+// LogLevelConfig overrides the log levels of requests.
+type LogLevelConfig struct {
+	Statuses map[string]string     `mapstructure:"statuses" desc:"log levels of HTTP statuses or classes overriding the defaults, e.g. 404: info or 4xx: info"`
+	Routes   []logfilter.LevelRule `mapstructure:"routes" validate:"dive" desc:"log levels of successful requests by path or route template"`
+}
+
+func (cfg LogLevelConfig) options() ([]http_middleware.LogOption, error) {
+	levels := map[string]zapcore.Level{}
+	for status, level := range cfg.Statuses {
+		l, err := logfilter.ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.ToLower(status)] = l
+	}
+	routes, err := logfilter.NewLevels(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+	return []http_middleware.LogOption{
+		http_middleware.WithStatusToLevel(func(status int) zapcore.Level {
+			if l, ok := levels[strconv.Itoa(status)]; ok {
+				return l
+			}
+			if l, ok := levels[strconv.Itoa(status/100)+"xx"]; ok {
+				return l
+			}
+			return http_middleware.DefaultStatusToLevel(status)
+		}),
+		http_middleware.WithLevels(routes),
+	}, nil
+}
+
+func (cfg Config) logOptions() ([]http_middleware.LogOption, error) {
+	if _, err := logfilter.NewMatcher(cfg.LogIgnorePaths...); err != nil {
+		return nil, fmt.Errorf("invalid http.log-ignore-paths: %w", err)
+	}
+	sampler, err := logfilter.NewSampler(cfg.LogSampling)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.log-sampling: %w", err)
+	}
+	slow, err := logfilter.NewSlowDetector(cfg.LogSlow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.log-slow: %w", err)
+	}
+	opts, err := cfg.LogLevels.options()
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.log-levels: %w", err)
+	}
+	opts = append(opts,
+		http_middleware.SkipURL(cfg.LogIgnorePaths...),
+		http_middleware.WithSampler(sampler),
+		http_middleware.WithSlowDetector(slow),
+	)
+	if cfg.H2c {
+		// do not log bodies of h2c, they may be streams
+		return append(opts, http_middleware.WithLogBody(false)), nil
+	}
+	return append(opts,
+		http_middleware.WithLogBody(cfg.LogAllRequest),
+		http_middleware.WithLogResponseBody(cfg.LogResponseBody),
+		http_middleware.WithMaxBodySize(cfg.LogBodyMaxBytes),
+		http_middleware.WithBodyContentTypes(cfg.LogBodyContentTypes...),
+	), nil
+}
+
 type wrappedCfg struct {
 	Http Config `mapstructure:"http"`
 }
 
 func ReadConfig(v *viper.Viper) (Config, error) {
 	cfg := &wrappedCfg{}
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
 		return Config{}, err
 	}
 	cfg.Http.ListenPort = utils.GetDefaultPort("http", cfg.Http.ListenPort)
@@ -97,10 +200,10 @@ func Module(force bool) fx.Option {
 			cfg_module.SetDefaultConfig(DefaultConfig),
 			fx.Provide(
 				ReadConfig,
+				NewErrorRedactor,
 				NewEcho,
 			),
 			fx.Invoke(
-				CheckConfig,
 				noop,
 			),
 		)
@@ -109,14 +212,22 @@ func Module(force bool) fx.Option {
 		cfg_module.SetDefaultConfig(DefaultConfig),
 		fx.Provide(
 			ReadConfig,
+			NewErrorRedactor,
 			NewEcho,
 		),
-		fx.Invoke(
-			CheckConfig,
-		),
 	)
 }
 
+// NewErrorRedactor returns the redactor of http.error-redaction, used by
+// the error handler of echo, and by the gateway with gateway_module.
+func NewErrorRedactor(cfg Config) (*errorpb.Redactor, error) {
+	redactor, err := errorpb.NewRedactor(cfg.ErrorRedaction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.error-redaction: %w", err)
+	}
+	return redactor, nil
+}
+
 // need to invoke echo
 func noop(e *echo.Echo) {}
 
@@ -126,8 +237,18 @@ func NewEcho(
 	cfg Config,
 	serviceParams svc_module.OptionalConfig,
 	ocfg optionalParams,
-) *echo.Echo {
+	v *viper.Viper,
+	redactor *errorpb.Redactor,
+) (*echo.Echo, error) {
+	if err := errorpb.CheckRegistry(); err != nil {
+		return nil, err
+	}
+	logOpts, err := cfg.logOptions()
+	if err != nil {
+		return nil, err
+	}
 	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler(DefaultErrorMarshaler, errorpb.WithRedactor(redactor))
 	e.HideBanner = true
 	e.HidePort = true
 	e.Logger.SetLevel(log.OFF)
@@ -153,7 +274,9 @@ func NewEcho(
 				return nil
 			},
 		}),
-		http_middleware.EchoRequestID(),
+		http_middleware.EchoRequestID(cfg.RequestID.Options()...),
+		// count errors by ID and fire alerts
+		alert_module.EchoMiddleware(ocfg.Monitor),
 		middleware.CORSWithConfig(middleware.CORSConfig{
 			AllowCredentials: true,
 			AllowOrigins:     cfg.CORS.AllowOrigins,
@@ -162,34 +285,28 @@ func NewEcho(
 	)
 
 	if ocfg.TraceCfg.Fraction > 0 && ocfg.TraceCfg.Driver != "none" {
-		// TODO: here
-		skippedUrl := map[string]bool{}
-		for _, p := range cfg.LogIgnorePaths {
-			skippedUrl[p] = true
-		}
+		skipped := logfilter.MustMatcher(cfg.LogIgnorePaths...)
 		skipper := otelecho.WithSkipper(
 			func(c echo.Context) bool {
-				return skippedUrl[c.Path()]
+				return skipped.Match(c.Request().URL.Path, c.Path())
 			})
 		e.Use(otelecho.Middleware(service, skipper))
 	}
+	// after otelecho, so that values can be read from inbound baggage
+	e.Use(propagation_module.EchoMiddleware(ocfg.Propagator))
 
-	if cfg.H2c {
-		e.Use(
-			http_middleware.EchoRequestLogger(
-				logger,
-				http_middleware.WithLogBody(false), // do not use log body for h2c
-				http_middleware.SkipURL(cfg.LogIgnorePaths...),
-			),
-		)
-	} else {
-		e.Use(
-			http_middleware.EchoRequestLogger(
-				logger,
-				http_middleware.WithLogBody(cfg.LogAllRequest),
-				http_middleware.SkipURL(cfg.LogIgnorePaths...),
-			),
-		)
+	if ocfg.Redactor != nil {
+		logOpts = append(logOpts, http_middleware.WithRedactor(ocfg.Redactor))
+	}
+	e.Use(http_middleware.EchoRequestLogger(logger, logOpts...))
+	// after the logger, so that rejected requests are logged with their tenant
+	e.Use(tenant_module.EchoMiddleware(ocfg.Tenancy))
+
+	if cfg.ConfigPath != "" {
+		e.GET(cfg.ConfigPath, ConfigHandler(v), ConfigAuth(cfg.ConfigToken))
+	}
+	if cfg.ErrorsPath != "" {
+		e.GET(cfg.ErrorsPath, echo.WrapHandler(errorpb.CatalogHandler()))
 	}
 
 	p := prometheus.NewPrometheus(service, func(c echo.Context) bool {
@@ -253,5 +370,32 @@ func NewEcho(
 		},
 	})
 
-	return e
+	return e, nil
+}
+
+// ConfigAuth returns a middleware that rejects the requests without the
+// bearer token.
+func ConfigAuth(token string) echo.MiddlewareFunc {
+	return middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		return token != "" && subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1, nil
+	})
+}
+
+// ConfigHandler serves the effective config of v in yaml, or json with
+// `?format=json`, annotated with the source of each key.
+// Sensitive values are redacted, but the rest, e.g. hosts and ports, is
+// served as is, so it should be served behind ConfigAuth or an internal
+// listener.
+func ConfigHandler(v *viper.Viper) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		format := c.QueryParam("format")
+		out, err := cfg_module.Dump(v, format)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if format == "json" {
+			return c.JSONBlob(http.StatusOK, out)
+		}
+		return c.Blob(http.StatusOK, "application/yaml", out)
+	}
 }
@@ -0,0 +1,37 @@
+package http_module
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+func TestConfigAuth(t *testing.T) {
+	v := viper.New()
+	v.Set("http.config-token", "s3cr3t")
+	e := echo.New()
+	e.GET("/config", ConfigHandler(v), ConfigAuth("s3cr3t"))
+	e.GET("/unset", ConfigHandler(v), ConfigAuth(""))
+	for _, c := range []struct {
+		path, auth string
+		want       int
+	}{
+		{"/config", "", http.StatusBadRequest},
+		{"/config", "Bearer wrong", http.StatusUnauthorized},
+		{"/config", "Bearer s3cr3t", http.StatusOK},
+		{"/unset", "Bearer x", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, c.auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("GET %s with %q = %d, want %d", c.path, c.auth, rec.Code, c.want)
+		}
+	}
+}
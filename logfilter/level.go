@@ -0,0 +1,70 @@
+package logfilter
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelRule sets the log level of the requests matching a pattern.
+type LevelRule struct {
+	Match string `mapstructure:"match" validate:"required" desc:"pattern of paths, route templates or grpc methods"`
+	Level string `mapstructure:"level" validate:"oneof=debug info warn error" desc:"log level of the successful requests"`
+}
+
+type levelRule struct {
+	m     *Matcher
+	level zapcore.Level
+}
+
+// Levels overrides the log levels of successful requests by the first
+// matching rule, e.g. to log a chatty polling method at debug.
+// Failed requests keep their level, so that failures stay visible.
+// A nil Levels overrides nothing.
+type Levels struct {
+	rules []levelRule
+}
+
+// NewLevels returns the Levels of rules, or nil if there is no rule.
+func NewLevels(rules []LevelRule) (*Levels, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	l := &Levels{}
+	for _, r := range rules {
+		m, err := NewMatcher(r.Match)
+		if err != nil {
+			return nil, err
+		}
+		level, err := ParseLevel(r.Level)
+		if err != nil {
+			return nil, err
+		}
+		l.rules = append(l.rules, levelRule{m: m, level: level})
+	}
+	return l, nil
+}
+
+// Apply returns the overridden level of a request named by names, e.g. its
+// path and route, whose level is level. ok reports whether the request
+// succeeded, i.e. its code is OK or its status is 2xx.
+func (l *Levels) Apply(level zapcore.Level, ok bool, names ...string) zapcore.Level {
+	if l == nil || !ok {
+		return level
+	}
+	for _, r := range l.rules {
+		if r.m.Match(names...) {
+			return r.level
+		}
+	}
+	return level
+}
+
+// ParseLevel parses a log level name, e.g. debug or warn.
+func ParseLevel(name string) (zapcore.Level, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", name, err)
+	}
+	return level, nil
+}
@@ -0,0 +1,143 @@
+// Package logfilter selects the requests logged by the HTTP and gRPC
+// request loggers, by patterns of paths, route templates and method names,
+// and by sampling.
+package logfilter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Matcher matches names, e.g. URL paths, echo route templates like
+// `/users/:id`, or grpc full method names, against patterns.
+//
+// A pattern prefixed with `re:` is a regular expression, otherwise it is a
+// glob where `*` matches within a path segment and `**` matches across
+// segments, e.g. `/static/**` or `/pkg.Service/*`.
+// A nil Matcher matches nothing.
+type Matcher struct {
+	res []*regexp.Regexp
+}
+
+// NewMatcher returns the Matcher of patterns.
+func NewMatcher(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, p := range patterns {
+		expr := globToRegexp(p)
+		if strings.HasPrefix(p, "re:") {
+			expr = strings.TrimPrefix(p, "re:")
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		m.res = append(m.res, re)
+	}
+	return m, nil
+}
+
+// MustMatcher is like NewMatcher but panics on invalid patterns.
+func MustMatcher(patterns ...string) *Matcher {
+	m, err := NewMatcher(patterns...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Match reports whether any of names matches any pattern, empty names are ignored.
+func (m *Matcher) Match(names ...string) bool {
+	if m == nil {
+		return false
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, re := range m.res {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Rule samples the successful requests matching a pattern.
+type Rule struct {
+	Match string        `mapstructure:"match" validate:"required" desc:"pattern of paths, route templates or grpc methods, see logfilter.Matcher"`
+	Every int           `mapstructure:"every" validate:"gte=0" desc:"log 1 in every N successful requests, 0 or 1 logs all"`
+	Slow  time.Duration `mapstructure:"slow" desc:"requests slower than this are always logged, 0 disables"`
+}
+
+type rule struct {
+	Rule
+	m *Matcher
+	n uint64
+}
+
+// Sampler logs 1 in every N successful requests of the first matching
+// rule. Failed requests and requests of no rule are always logged.
+// A nil Sampler logs all requests.
+type Sampler struct {
+	rules []*rule
+}
+
+// NewSampler returns the Sampler of rules, or nil if there is no rule.
+func NewSampler(rules []Rule) (*Sampler, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	s := &Sampler{}
+	for _, r := range rules {
+		m, err := NewMatcher(r.Match)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, &rule{Rule: r, m: m})
+	}
+	return s, nil
+}
+
+// Sample reports whether a request named by names, e.g. its path and route,
+// is logged.
+func (s *Sampler) Sample(failed bool, latency time.Duration, names ...string) bool {
+	if s == nil || failed {
+		return true
+	}
+	for _, r := range s.rules {
+		if !r.m.Match(names...) {
+			continue
+		}
+		if r.Every <= 1 || (r.Slow > 0 && latency >= r.Slow) {
+			return true
+		}
+		return atomic.AddUint64(&r.n, 1)%uint64(r.Every) == 1
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package logfilter
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestMatcher(t *testing.T) {
+	m := MustMatcher("/healthz", "/static/**", "/users/:id", "/pkg.Svc/*", `re:^/debug/\d+$`)
+	tests := map[string]bool{
+		"/healthz":         true,
+		"/healthz/x":       false,
+		"/static/a/b.js":   true,
+		"/users/:id":       true,
+		"/pkg.Svc/Get":     true,
+		"/pkg.Svc/a/b":     false,
+		"/debug/12":        true,
+		"/debug/x":         false,
+		"/other.Svc/Get":   false,
+		"/static-file.css": false,
+	}
+	for name, want := range tests {
+		if got := m.Match(name); got != want {
+			t.Errorf("Match(%s) = %v, want %v", name, got, want)
+		}
+	}
+	if _, err := NewMatcher("re:("); err == nil {
+		t.Error("invalid regexp is accepted")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s, err := NewSampler([]Rule{{Match: "/poll", Every: 3, Slow: time.Second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := 0
+	for i := 0; i < 9; i++ {
+		if s.Sample(false, time.Millisecond, "/poll") {
+			logged++
+		}
+	}
+	if logged != 3 {
+		t.Errorf("logged %d of 9, want 3", logged)
+	}
+	if !s.Sample(true, 0, "/poll") || !s.Sample(false, 2*time.Second, "/poll") || !s.Sample(false, 0, "/other") {
+		t.Error("failed, slow and unmatched requests are always logged")
+	}
+}
+
+func TestSlowDetector(t *testing.T) {
+	d, err := NewSlowDetector([]SlowRule{
+		{Match: "/pkg.Svc/Export", Latency: 10 * time.Second},
+		{Match: "**", Latency: time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Threshold("/pkg.Svc/Export"); got != 10*time.Second {
+		t.Errorf("Threshold = %v, want 10s", got)
+	}
+	threshold := d.Threshold("/pkg.Svc/Get")
+	if Observe("grpc", "/pkg.Svc/Get", threshold, 500*time.Millisecond) || !Observe("grpc", "/pkg.Svc/Get", threshold, 2*time.Second) {
+		t.Error("unexpected slow detection")
+	}
+	if Observe("grpc", "/pkg.Svc/Get", 0, time.Hour) {
+		t.Error("requests without threshold are never slow")
+	}
+}
+
+func TestLevels(t *testing.T) {
+	l, err := NewLevels([]LevelRule{{Match: "/pkg.Svc/Poll", Level: "debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Apply(zapcore.InfoLevel, true, "/pkg.Svc/Poll"); got != zapcore.DebugLevel {
+		t.Errorf("Apply(info) = %v, want debug", got)
+	}
+	if got := l.Apply(zapcore.InfoLevel, false, "/pkg.Svc/Poll"); got != zapcore.InfoLevel {
+		t.Errorf("Apply(info) = %v, failures are not overridden", got)
+	}
+	if got := l.Apply(zapcore.InfoLevel, true, "/pkg.Svc/Get"); got != zapcore.InfoLevel {
+		t.Errorf("Apply(info) = %v, want info", got)
+	}
+	if _, err := NewLevels([]LevelRule{{Match: "**", Level: "loud"}}); err == nil {
+		t.Error("invalid level is accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package logfilter
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logfilter_request_duration_seconds",
+		Help:    "Latency of the requests with a slow threshold, by transport and method or route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"transport", "method"})
+	slowRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logfilter_slow_requests_total",
+		Help: "Total number of requests slower than their threshold, by transport and method or route.",
+	}, []string{"transport", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration, slowRequests)
+}
+
+// SlowRule sets the latency threshold of the requests matching a pattern.
+type SlowRule struct {
+	Match   string        `mapstructure:"match" validate:"required" desc:"pattern of paths, route templates or grpc methods, ** for all"`
+	Latency time.Duration `mapstructure:"latency" validate:"gt=0" desc:"requests slower than this are logged at warn"`
+}
+
+type slowRule struct {
+	SlowRule
+	m *Matcher
+}
+
+// SlowDetector finds the requests slower than the threshold of the first
+// matching rule. A nil SlowDetector finds nothing.
+type SlowDetector struct {
+	rules []slowRule
+}
+
+// NewSlowDetector returns the SlowDetector of rules, or nil if there is no rule.
+func NewSlowDetector(rules []SlowRule) (*SlowDetector, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	d := &SlowDetector{}
+	for _, r := range rules {
+		m, err := NewMatcher(r.Match)
+		if err != nil {
+			return nil, err
+		}
+		d.rules = append(d.rules, slowRule{SlowRule: r, m: m})
+	}
+	return d, nil
+}
+
+// Threshold returns the threshold of a request named by names, e.g. its
+// path and route, or 0 if there is none.
+func (d *SlowDetector) Threshold(names ...string) time.Duration {
+	if d == nil {
+		return 0
+	}
+	for _, r := range d.rules {
+		if r.m.Match(names...) {
+			return r.Latency
+		}
+	}
+	return 0
+}
+
+// Observe records the latency of a request of transport, e.g. http or grpc,
+// and method, its route or grpc full method, with threshold. It reports
+// whether the request is slow.
+func Observe(transport, method string, threshold, latency time.Duration) bool {
+	if threshold <= 0 {
+		return false
+	}
+	requestDuration.WithLabelValues(transport, method).Observe(latency.Seconds())
+	if latency < threshold {
+		return false
+	}
+	slowRequests.WithLabelValues(transport, method).Inc()
+	return true
+}
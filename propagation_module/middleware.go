@@ -0,0 +1,92 @@
+package propagation_module
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// incoming reads the declared values from the incoming metadata of ctx.
+func (p *Propagator) incoming(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return p.Extract(ctx, func(header string) string {
+		if v := md.Get(header); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	})
+}
+
+// outgoing adds the declared values of ctx to the outgoing metadata, values
+// already set by the caller are kept.
+func (p *Propagator) outgoing(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var kv []string
+	p.Inject(ctx, func(header, value string) {
+		if len(md.Get(header)) == 0 {
+			kv = append(kv, header, value)
+		}
+	})
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor that reads
+// the declared values of calls with p, which may be nil.
+func UnaryServerInterceptor(p *Propagator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(p.incoming(ctx), req)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor, see
+// UnaryServerInterceptor.
+func StreamServerInterceptor(p *Propagator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: stream, ctx: p.incoming(stream.Context())})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryClientInterceptor returns a new unary client interceptor that
+// forwards the declared values to outbound calls with p, which may be nil.
+func UnaryClientInterceptor(p *Propagator) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(p.outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a new streaming client interceptor, see
+// UnaryClientInterceptor.
+func StreamClientInterceptor(p *Propagator) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(p.outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// EchoMiddleware reads the declared values of requests with p, which may
+// be nil, into the request context.
+func EchoMiddleware(p *Propagator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if p == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(p.Extract(req.Context(), req.Header.Get)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package propagation_module propagates request-scoped values, e.g. tenant
+// ID, user ID, locale and experiment flags, across echo, the grpc server,
+// the gateway and the clients created by grpc_module.Dialer.
+//
+// Values are set by WithValue, e.g. by authentication, or read from the
+// headers or metadata of inbound requests for the keys declared as trusted,
+// falling back to OTel baggage if allowed. They are forwarded in the same
+// headers to outbound calls as well as in baggage, and are logged by the
+// request loggers under `propagated`.
+package propagation_module
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/baggage"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/viperutil"
+)
+
+type Config struct {
+	Keys      []Key `mapstructure:"keys" validate:"dive" desc:"values propagated from inbound requests to outbound calls, logs and OTel baggage"`
+	MaxLength int   `mapstructure:"max-length" validate:"gt=0" desc:"inbound values longer than this, or with control characters, are dropped"`
+}
+
+// Key declares a propagated value. Values of untrusted keys, e.g. user IDs,
+// are only set by WithValue, since any client can send the header.
+type Key struct {
+	Name        string `mapstructure:"name" validate:"required" desc:"name in context, logs and baggage, e.g. locale"`
+	Header      string `mapstructure:"header" validate:"required" desc:"header or metadata carrying the value to outbound calls, e.g. x-locale"`
+	Trusted     bool   `mapstructure:"trusted" desc:"read the value from the header of inbound requests, only if it is set by trusted callers or for values that are not identities"`
+	FromBaggage bool   `mapstructure:"from-baggage" desc:"read the value of a trusted key from inbound OTel baggage when the header is missing"`
+}
+
+var DefaultConfig = wrappedCfg{
+	Propagation: Config{
+		MaxLength: 256,
+	},
+}
+
+type wrappedCfg struct {
+	Propagation Config `mapstructure:"propagation"`
+}
+
+func ReadConfig(v *viper.Viper) (Config, error) {
+	cfg := &wrappedCfg{}
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg.Propagation, nil
+}
+
+func CheckConfig(cfg Config) error {
+	return validator.New().Struct(&cfg)
+}
+
+// Module provides *Propagator, which grpc_module, http_module and
+// gateway_module use to propagate values. Nothing is propagated without it.
+func Module() fx.Option {
+	return fx.Options(
+		cfg_module.SetDefaultConfig(DefaultConfig),
+		fx.Provide(
+			ReadConfig,
+			NewPropagator,
+		),
+	)
+}
+
+// Values are the propagated values of a request by key name.
+type Values map[string]string
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, names are sorted.
+func (v Values) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		enc.AddString(name, v[name])
+	}
+	return nil
+}
+
+type valuesKey struct{}
+
+// FromContext returns the propagated values of ctx, which must not be modified.
+func FromContext(ctx context.Context) Values {
+	values, _ := ctx.Value(valuesKey{}).(Values)
+	return values
+}
+
+// Value returns the propagated value of name in ctx.
+func Value(ctx context.Context, name string) string {
+	return FromContext(ctx)[name]
+}
+
+// WithValue returns a copy of ctx with the value of name set, e.g. by an
+// authentication middleware. It is forwarded in baggage, and in its header
+// if name is a declared key. An empty value removes name.
+func WithValue(ctx context.Context, name, value string) context.Context {
+	old := FromContext(ctx)
+	values := make(Values, len(old)+1)
+	for k, v := range old {
+		values[k] = v
+	}
+	if value == "" {
+		delete(values, name)
+		ctx = baggage.ContextWithBaggage(ctx, baggage.FromContext(ctx).DeleteMember(name))
+	} else {
+		values[name] = value
+	}
+	return newContext(ctx, values)
+}
+
+// newContext stores values in ctx and in its baggage.
+func newContext(ctx context.Context, values Values) context.Context {
+	bag := baggage.FromContext(ctx)
+	for name, value := range values {
+		m, err := baggage.NewMemberRaw(name, value)
+		if err != nil {
+			continue
+		}
+		if b, err := bag.SetMember(m); err == nil {
+			bag = b
+		}
+	}
+	return context.WithValue(baggage.ContextWithBaggage(ctx, bag), valuesKey{}, values)
+}
+
+// Field returns the zap field of the propagated values of ctx, it is
+// skipped if there is none.
+func Field(ctx context.Context) zap.Field {
+	values := FromContext(ctx)
+	if len(values) == 0 {
+		return zap.Skip()
+	}
+	return zap.Object("propagated", values)
+}
+
+// Propagator reads the declared values from inbound requests and forwards
+// them to outbound calls. A nil Propagator propagates nothing.
+type Propagator struct {
+	keys      []Key
+	maxLength int
+}
+
+// NewPropagator returns the Propagator of cfg.
+func NewPropagator(cfg Config) (*Propagator, error) {
+	p := &Propagator{maxLength: cfg.MaxLength}
+	for _, k := range cfg.Keys {
+		if _, err := baggage.NewKeyProperty(k.Name); err != nil {
+			return nil, fmt.Errorf("invalid propagation key name %q: %w", k.Name, err)
+		}
+		k.Header = strings.ToLower(k.Header)
+		p.keys = append(p.keys, k)
+	}
+	return p, nil
+}
+
+// Headers returns the headers carrying the declared values.
+func (p *Propagator) Headers() []string {
+	if p == nil {
+		return nil
+	}
+	headers := make([]string, 0, len(p.keys))
+	for _, k := range p.keys {
+		headers = append(headers, k.Header)
+	}
+	return headers
+}
+
+// Extract returns a copy of ctx with the values of the trusted keys read by
+// get from the headers of an inbound request, or from the baggage of ctx.
+func (p *Propagator) Extract(ctx context.Context, get func(header string) string) context.Context {
+	if p == nil {
+		return ctx
+	}
+	bag := baggage.FromContext(ctx)
+	values := Values{}
+	for name, value := range FromContext(ctx) {
+		values[name] = value
+	}
+	for _, k := range p.keys {
+		if !k.Trusted {
+			continue
+		}
+		value := get(k.Header)
+		if value == "" && k.FromBaggage {
+			value = bag.Member(k.Name).Value()
+		}
+		if value != "" && p.valid(value) {
+			values[k.Name] = value
+		}
+	}
+	if len(values) == 0 {
+		return ctx
+	}
+	return newContext(ctx, values)
+}
+
+func (p *Propagator) valid(value string) bool {
+	if len(value) > p.maxLength {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < ' ' || value[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Inject calls set with the header and value of each declared value of ctx.
+func (p *Propagator) Inject(ctx context.Context, set func(header, value string)) {
+	if p == nil {
+		return
+	}
+	values := FromContext(ctx)
+	for _, k := range p.keys {
+		if value, ok := values[k.Name]; ok {
+			set(k.Header, value)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package propagation_module
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPropagator(t *testing.T) {
+	cfg := DefaultConfig.Propagation
+	cfg.Keys = []Key{
+		{Name: "tenant_id", Header: "x-tenant-id", Trusted: true},
+		{Name: "user_id", Header: "x-user-id"},
+		{Name: "locale", Header: "x-locale", Trusted: true, FromBaggage: true},
+		{Name: "region", Header: "x-region", Trusted: true},
+		{Name: "flags", Header: "x-flags", Trusted: true},
+	}
+	p, err := NewPropagator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, _ := baggage.Parse("locale=ja-JP,region=eu,user_id=1")
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(
+		"x-tenant-id", "acme",
+		"x-user-id", "spoofed", // untrusted
+		"x-flags", "a\nb", // control character
+	))
+	ctx = p.incoming(ctx)
+
+	if got := FromContext(ctx); len(got) != 2 || got["tenant_id"] != "acme" || got["locale"] != "ja-JP" {
+		t.Errorf("FromContext() = %v", got)
+	}
+	long := p.Extract(context.Background(), func(string) string { return strings.Repeat("u", 257) })
+	if got := FromContext(long); len(got) != 0 {
+		t.Errorf("FromContext() = %v, want values longer than max-length dropped", got)
+	}
+	if got := baggage.FromContext(ctx).Member("tenant_id").Value(); got != "acme" {
+		t.Errorf("baggage tenant_id = %q", got)
+	}
+
+	ctx = WithValue(ctx, "user_id", "42")
+	ctx = WithValue(ctx, "locale", "")
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-user-id", "set-by-caller", "x-locale", "en-US")
+	md, _ := metadata.FromOutgoingContext(p.outgoing(ctx))
+	for header, want := range map[string]string{"x-tenant-id": "acme", "x-user-id": "set-by-caller", "x-locale": "en-US", "x-region": "", "x-flags": ""} {
+		if got := strings.Join(md.Get(header), ","); got != want {
+			t.Errorf("outgoing %s = %q, want %q", header, got, want)
+		}
+	}
+	if got := baggage.FromContext(ctx).Member("locale").Key(); got != "" {
+		t.Errorf("baggage locale is not removed")
+	}
+
+	if _, err := NewPropagator(Config{Keys: []Key{{Name: "bad name", Header: "x-bad"}}}); err == nil {
+		t.Error("NewPropagator() accepted an invalid key name")
+	}
+}
@@ -0,0 +1,100 @@
+package redact
+
+import (
+	"sort"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultHeaderDenyList are the headers and metadata whose values are masked by default.
+var DefaultHeaderDenyList = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// HeaderFilter selects the logged HTTP headers or gRPC metadata and masks
+// sensitive ones, names are case insensitive.
+type HeaderFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+	mask  string
+}
+
+// NewHeaderFilter returns a HeaderFilter that keeps only the headers in
+// allow, or all headers if allow is empty, and masks the values of the
+// headers in deny.
+func NewHeaderFilter(allow, deny []string, mask string) *HeaderFilter {
+	f := &HeaderFilter{
+		allow: map[string]bool{},
+		deny:  map[string]bool{},
+		mask:  mask,
+	}
+	for _, h := range allow {
+		f.allow[strings.ToLower(h)] = true
+	}
+	for _, h := range deny {
+		f.deny[strings.ToLower(h)] = true
+	}
+	return f
+}
+
+// Selective reports whether only some headers are kept.
+func (f *HeaderFilter) Selective() bool {
+	return f != nil && len(f.allow) > 0
+}
+
+// Filter returns the kept headers of h with the denied ones masked, h is not
+// modified. A nil HeaderFilter returns h as is.
+func (f *HeaderFilter) Filter(h map[string][]string) map[string][]string {
+	if f == nil {
+		return h
+	}
+	out := make(map[string][]string, len(h))
+	for k, vs := range h {
+		name := strings.ToLower(k)
+		if len(f.allow) > 0 && !f.allow[name] {
+			continue
+		}
+		if f.deny[name] {
+			masked := make([]string, len(vs))
+			for i := range masked {
+				masked[i] = f.mask
+			}
+			vs = masked
+		}
+		out[k] = vs
+	}
+	return out
+}
+
+// Object returns the filtered h as a log object.
+func (f *HeaderFilter) Object(h map[string][]string) zapcore.ObjectMarshaler {
+	return headers(f.Filter(h))
+}
+
+type headers map[string][]string
+
+func (h headers) MarshalLogObject(e zapcore.ObjectEncoder) error {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vs := h[k]
+		if err := e.AddArray(k, zapcore.ArrayMarshalerFunc(func(ae zapcore.ArrayEncoder) error {
+			for _, v := range vs {
+				ae.AppendString(v)
+			}
+			return nil
+		})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
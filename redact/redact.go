@@ -0,0 +1,275 @@
+// Package redact masks sensitive values of logged payloads, it is shared by
+// the HTTP and gRPC request loggers.
+//
+// Values are masked if their JSON key or form field is one of the configured
+// keys, if they match one of the configured patterns, e.g. card numbers and
+// emails, or if their proto field is marked with `debug_redact` or
+// `(redact.sensitive)`.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type Config struct {
+	Keys     []string `mapstructure:"keys" desc:"JSON keys and form fields whose values are masked, case, '_' and '-' are ignored"`
+	Patterns []string `mapstructure:"patterns" desc:"regular expressions of masked values, e.g. card numbers and emails"`
+	Mask     string   `mapstructure:"mask" desc:"replacement of masked values"`
+
+	Headers        []string `mapstructure:"headers" desc:"logged HTTP headers and grpc metadata, all when empty"`
+	HeaderDenyList []string `mapstructure:"header-deny-list" desc:"HTTP headers and grpc metadata whose values are masked"`
+}
+
+var DefaultConfig = Config{
+	Keys: []string{
+		"password", "passwd", "secret", "token", "access_token", "refresh_token",
+		"api_key", "authorization", "credit_card", "card_number", "cvv",
+	},
+	Patterns: []string{
+		`\b(?:4\d{3}|5[1-5]\d{2}|6011)(?:[ -]?\d{4}){3}\b`, // visa, mastercard and discover numbers
+		`\b3[47]\d{2}[ -]?\d{6}[ -]?\d{5}\b`,               // amex numbers
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,   // emails
+	},
+	Mask:           "[REDACTED]",
+	HeaderDenyList: DefaultHeaderDenyList,
+}
+
+// Redactor masks sensitive values, see the package doc.
+// A nil Redactor masks nothing.
+type Redactor struct {
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+	mask     string
+	headers  *HeaderFilter
+}
+
+var defaultRedactor = mustNew(DefaultConfig)
+
+// Default returns the Redactor of DefaultConfig.
+func Default() *Redactor {
+	return defaultRedactor
+}
+
+// New returns the Redactor of cfg.
+func New(cfg Config) (*Redactor, error) {
+	r := &Redactor{
+		keys:    map[string]bool{},
+		mask:    cfg.Mask,
+		headers: NewHeaderFilter(cfg.Headers, cfg.HeaderDenyList, cfg.Mask),
+	}
+	for _, k := range cfg.Keys {
+		r.keys[normalize(k)] = true
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+func mustNew(cfg Config) *Redactor {
+	r, err := New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// normalize makes `access_token`, `accessToken` and `Access-Token` the same key.
+func normalize(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// Key reports whether the values of key are masked.
+func (r *Redactor) Key(key string) bool {
+	return r != nil && r.keys[normalize(key)]
+}
+
+// HeaderFilter returns the filter of the logged headers, nil if r is nil.
+func (r *Redactor) HeaderFilter() *HeaderFilter {
+	if r == nil {
+		return nil
+	}
+	return r.headers
+}
+
+// Mask returns the replacement of masked values, DefaultConfig.Mask if r is
+// nil.
+func (r *Redactor) Mask() string {
+	if r == nil {
+		return DefaultConfig.Mask
+	}
+	return r.mask
+}
+
+// String masks the parts of s matching the patterns.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, r.mask)
+	}
+	return s
+}
+
+// Body masks a request or response body of contentType, JSON and form
+// bodies are masked by keys, other bodies only by patterns.
+func (r *Redactor) Body(b []byte, contentType string) string {
+	if r == nil {
+		return string(b)
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if mt == "application/x-www-form-urlencoded" {
+		return r.form(string(b))
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return string(r.JSON(b))
+	}
+	return r.String(string(b))
+}
+
+// JSON masks b by keys and patterns. Invalid JSON, e.g. a truncated body,
+// is masked textually.
+func (r *Redactor) JSON(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return []byte(r.text(string(b)))
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r.value(v)); err != nil {
+		return []byte(r.text(string(b)))
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+func (r *Redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if r.Key(k) {
+				v[k] = r.mask
+			} else {
+				v[k] = r.value(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = r.value(e)
+		}
+	case string:
+		return r.String(v)
+	}
+	return v
+}
+
+// jsonPair matches `"key": value`, the value may be cut off.
+var jsonPair = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^\s,{}\[\]]*)`)
+
+func (r *Redactor) text(s string) string {
+	s = jsonPair.ReplaceAllStringFunc(s, func(pair string) string {
+		m := jsonPair.FindStringSubmatch(pair)
+		if !r.Key(m[1]) {
+			return pair
+		}
+		mask, _ := json.Marshal(r.mask)
+		return `"` + m[1] + `"` + m[2] + string(mask)
+	})
+	return r.String(s)
+}
+
+func (r *Redactor) form(s string) string {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return r.String(s)
+	}
+	for k, vs := range values {
+		for i := range vs {
+			if r.Key(k) {
+				vs[i] = r.mask
+			} else {
+				vs[i] = r.String(vs[i])
+			}
+		}
+	}
+	return values.Encode()
+}
+
+// Proto marshals m into JSON, with the fields marked with `debug_redact`
+// or `(redact.sensitive)` masked, as well as keys and patterns.
+func (r *Redactor) Proto(m proto.Message) ([]byte, error) {
+	if r == nil {
+		return protojson.Marshal(m)
+	}
+	m = proto.Clone(m)
+	r.message(m.ProtoReflect())
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return r.JSON(b), nil
+}
+
+func (r *Redactor) message(m protoreflect.Message) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		switch {
+		case sensitive(fd):
+			if fd.Kind() == protoreflect.StringKind && fd.Cardinality() != protoreflect.Repeated {
+				m.Set(fd, protoreflect.ValueOfString(r.mask))
+			} else {
+				m.Clear(fd)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				m.Mutable(fd).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					r.message(v.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				list := m.Mutable(fd).List()
+				for i := 0; i < list.Len(); i++ {
+					r.message(list.Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			r.message(m.Mutable(fd).Message())
+		}
+	}
+}
+
+// sensitive reports whether fd is marked with `debug_redact` or `(redact.sensitive)`.
+func sensitive(fd protoreflect.FieldDescriptor) bool {
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	if !ok || opts == nil {
+		return false
+	}
+	return opts.GetDebugRedact() || proto.GetExtension(opts, E_Sensitive).(bool)
+}
@@ -0,0 +1,113 @@
+package redact
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestBody(t *testing.T) {
+	r := Default()
+	tests := []struct {
+		body, contentType, want string
+	}{
+		{`{"user":{"Password":"p","name":"a@b.com"},"cards":["4111 1111 1111 1111"]}`, "application/json",
+			`{"cards":["[REDACTED]"],"user":{"Password":"[REDACTED]","name":"[REDACTED]"}}`},
+		{`{"accessToken": "abc", "id": 1697600000000, "passw`, "application/json",
+			`{"accessToken": "[REDACTED]", "id": 1697600000000, "passw`},
+		{`{"n": 1, "secret": "abc`, "", `{"n": 1, "secret": "[REDACTED]"`},
+		{`api-key=k&q=x`, "application/x-www-form-urlencoded", `api-key=%5BREDACTED%5D&q=x`},
+		{`mail me at a@b.com`, "text/plain", `mail me at [REDACTED]`},
+	}
+	for _, tt := range tests {
+		if got := r.Body([]byte(tt.body), tt.contentType); got != tt.want {
+			t.Errorf("Body(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestProto(t *testing.T) {
+	sensitiveOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(sensitiveOpts, E_Sensitive, true)
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+				field("phone", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, sensitiveOpts),
+				field("pin", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, &descriptorpb.FieldOptions{DebugRedact: proto.Bool(true)}),
+				field("friend", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, nil),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("User")
+	newUser := func(name string) *dynamicpb.Message {
+		m := dynamicpb.NewMessage(md)
+		m.Set(md.Fields().ByName("name"), protoreflect.ValueOfString(name))
+		m.Set(md.Fields().ByName("phone"), protoreflect.ValueOfString("123"))
+		m.Set(md.Fields().ByName("pin"), protoreflect.ValueOfInt32(42))
+		return m
+	}
+	m := newUser("a")
+	m.Set(md.Fields().ByName("friend"), protoreflect.ValueOfMessage(newUser("b")))
+
+	b, err := Default().Proto(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	friend := got["friend"].(map[string]interface{})
+	if got["phone"] != "[REDACTED]" || got["pin"] != nil || friend["phone"] != "[REDACTED]" || friend["name"] != "b" {
+		t.Errorf("unexpected redaction: %s", b)
+	}
+	if strings.Contains(m.Get(md.Fields().ByName("phone")).String(), "REDACTED") {
+		t.Error("the original message is modified")
+	}
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Type:     typ.Enum(),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Options:  opts,
+	}
+	if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		f.TypeName = proto.String(".test.User")
+	}
+	return f
+}
+
+func TestHeaderFilter(t *testing.T) {
+	h := map[string][]string{
+		"Authorization": {"Bearer t"},
+		"X-Request-Id":  {"id"},
+		"Accept":        {"*/*"},
+	}
+	got := Default().HeaderFilter().Filter(h)
+	if got["Authorization"][0] != "[REDACTED]" || got["Accept"][0] != "*/*" || h["Authorization"][0] != "Bearer t" {
+		t.Errorf("unexpected headers: %v", got)
+	}
+	got = NewHeaderFilter([]string{"x-request-id", "authorization"}, DefaultHeaderDenyList, "*").Filter(h)
+	if len(got) != 2 || got["Authorization"][0] != "*" || got["X-Request-Id"][0] != "id" {
+		t.Errorf("unexpected headers: %v", got)
+	}
+}
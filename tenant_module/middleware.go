@@ -0,0 +1,151 @@
+package tenant_module
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"pkg.lucas.icu/micro/propagation_module"
+)
+
+// incoming attributes a grpc call to its tenant, the host is :authority.
+// Calls carrying the token of a request checked by EchoMiddleware are
+// attributed to its tenant.
+func (t *Tenancy) incoming(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(name string) string {
+		if v := md.Get(name); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	if id, ok := t.edgeTenant(get(EdgeHeader)); ok {
+		ctx = propagation_module.WithValue(ctx, Key, id)
+		if id != "" {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", t.label(id)))
+		}
+		return context.WithValue(ctx, resolvedKey{}, resolution{edge: true})
+	}
+	return t.attribute(ctx, t.Resolve(get(":authority"), "", get))
+}
+
+// ResolveUnaryServerInterceptor returns a new unary server interceptor that
+// only attributes calls to tenants with t, which may be nil, so that the
+// tenant is logged by the interceptors between it and UnaryServerInterceptor.
+func ResolveUnaryServerInterceptor(t *Tenancy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if t.Skipped(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return handler(t.incoming(ctx), req)
+	}
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor that
+// attributes calls to tenants with t, which may be nil, unless done by
+// ResolveUnaryServerInterceptor, and rejects the calls without tenant in
+// strict mode and the calls over the rate limit of their tenant.
+func UnaryServerInterceptor(t *Tenancy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if t.Skipped(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if ok, _ := resolved(ctx); !ok {
+			ctx = t.incoming(ctx)
+		}
+		// requests checked by EchoMiddleware are counted and limited once
+		if _, edge := resolved(ctx); !edge {
+			if err := t.check(ctx, "grpc"); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor, see
+// UnaryServerInterceptor. The rate limit applies to the streams, not to
+// their messages.
+func StreamServerInterceptor(t *Tenancy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if t.Skipped(info.FullMethod) {
+			return handler(srv, stream)
+		}
+		ctx := stream.Context()
+		if ok, _ := resolved(ctx); !ok {
+			ctx = t.incoming(ctx)
+		}
+		if _, edge := resolved(ctx); !edge {
+			if err := t.check(ctx, "grpc"); err != nil {
+				return err
+			}
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// EchoMiddleware attributes requests to tenants with t, which may be nil,
+// and rejects the requests without tenant in strict mode and the requests
+// over the rate limit of their tenant. It should be used after the request
+// logger, so that rejected requests are logged.
+func EchoMiddleware(t *Tenancy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if t == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			req := c.Request()
+			if t.Skipped(req.URL.Path, c.Path()) {
+				return next(c)
+			}
+			ctx := t.attribute(req.Context(), t.Resolve(req.Host, req.URL.Path, req.Header.Get))
+			c.SetRequest(req.WithContext(ctx))
+			if err := t.check(ctx, "http"); err != nil {
+				return err
+			}
+			ctx, done := t.checkedAtEdge(ctx)
+			defer done()
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// outgoing adds the token of the request checked by EchoMiddleware, if
+// any, to the outgoing metadata, see EdgeHeader.
+func outgoing(ctx context.Context) context.Context {
+	token, ok := ctx.Value(edgeKey{}).(string)
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, EdgeHeader, token)
+}
+
+// UnaryClientInterceptor returns a new unary client interceptor that
+// forwards the token of requests checked by EchoMiddleware, see
+// EdgeHeader.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a new streaming client interceptor, see
+// UnaryClientInterceptor.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
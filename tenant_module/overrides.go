@@ -0,0 +1,68 @@
+package tenant_module
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const overridesKey = "tenants"
+
+// Overrides holds the config of each tenant, which is the config with the
+// sub-tree tenants.<id> merged on top of it:
+//
+//	welcome-message: hello
+//	tenants:
+//	  acme:
+//	    welcome-message: bonjour
+//
+// Tenant IDs are lower case, as viper keys.
+type Overrides struct {
+	base    *viper.Viper
+	tenants map[string]*viper.Viper
+}
+
+// NewOverrides reads the overrides of all tenants from v.
+func NewOverrides(v *viper.Viper) (*Overrides, error) {
+	o := &Overrides{base: v, tenants: map[string]*viper.Viper{}}
+	for id := range v.GetStringMap(overridesKey) {
+		settings := v.AllSettings()
+		delete(settings, overridesKey)
+		tv := viper.New()
+		if err := tv.MergeConfigMap(settings); err != nil {
+			return nil, fmt.Errorf("failed to read the config of tenant %s: %w", id, err)
+		}
+		if err := tv.MergeConfigMap(v.GetStringMap(overridesKey + "." + id)); err != nil {
+			return nil, fmt.Errorf("failed to read the config overrides of tenant %s: %w", id, err)
+		}
+		o.tenants[id] = tv
+	}
+	return o, nil
+}
+
+// Tenants returns the sorted IDs of the tenants with overrides.
+func (o *Overrides) Tenants() []string {
+	ids := make([]string, 0, len(o.tenants))
+	for id := range o.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Viper returns the config of the tenant id, the config itself if it has
+// no overrides. Configs are read from it as usual, e.g. ReadConfig(v).
+func (o *Overrides) Viper(id string) *viper.Viper {
+	if v, ok := o.tenants[strings.ToLower(id)]; ok {
+		return v
+	}
+	return o.base
+}
+
+// Context returns the config of the tenant of ctx, see Viper.
+func (o *Overrides) Context(ctx context.Context) *viper.Viper {
+	return o.Viper(FromContext(ctx))
+}
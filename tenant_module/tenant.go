@@ -0,0 +1,464 @@
+// Package tenant_module attributes requests to tenants when several tenants
+// are served from one deployment.
+//
+// The tenant ID is resolved from the host, a header, a JWT claim or a path
+// prefix, and stored as the propagated value tenant_id (see
+// propagation_module), so that it is logged, added to baggage and forwarded
+// by the clients created by grpc_module.Dialer if tenant_id is a declared key.
+// It is also set on the span and used as a metric label, tenants that are
+// not configured are labeled other. Requests of each tenant are rate limited, and
+// requests without tenant are rejected in strict mode.
+//
+// Requests checked by EchoMiddleware are not checked again by the server
+// interceptors when the handler calls the same service through a client of
+// grpc_module.Dialer, e.g. in the gateway, see EdgeHeader. Such calls take the
+// tenant of the request even if tenant_id is not a declared key.
+package tenant_module
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/errorpb"
+	"pkg.lucas.icu/micro/logfilter"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/viperutil"
+)
+
+// Key is the name of the propagated value of the tenant ID.
+const Key = "tenant_id"
+
+type Config struct {
+	Sources         []Source  `mapstructure:"sources" validate:"dive" desc:"sources of the tenant ID, tried in order"`
+	Known           []string  `mapstructure:"known" desc:"known tenant IDs, any valid ID when empty"`
+	Default         string    `mapstructure:"default" desc:"tenant of requests without tenant when not strict"`
+	Strict          bool      `mapstructure:"strict" desc:"reject requests that can't be attributed to a tenant"`
+	TrustPropagated bool      `mapstructure:"trust-propagated" desc:"accept the tenant propagated by upstream services, e.g. the gateway, when no source matches, disable it where clients can set the propagated headers"`
+	Skip            []string  `mapstructure:"skip" desc:"patterns of grpc full methods and http paths without tenant, e.g. /healthz"`
+	RateLimit       RateLimit `mapstructure:"rate-limit" desc:"rate limit of each tenant, overridden by tenants.<id>.tenant.rate-limit"`
+}
+
+// Source is a source of the tenant ID.
+type Source struct {
+	Type   string `mapstructure:"type" validate:"oneof=host header claim path" desc:"host, header, claim or path"`
+	Header string `mapstructure:"header" validate:"required_if=Type header" desc:"header or metadata of the header source, or carrying the bearer token of the claim source, authorization by default"`
+	Claim  string `mapstructure:"claim" validate:"required_if=Type claim" desc:"JWT claim of the claim source, the token is not verified"`
+	Suffix string `mapstructure:"suffix" validate:"required_if=Type host" desc:"domain suffix of the host source, e.g. .example.com, the tenant is the label before it"`
+	Prefix string `mapstructure:"prefix" desc:"path prefix of the path source, / by default, the tenant is the segment after it"`
+}
+
+// RateLimit limits the requests of a tenant, over grpc and http.
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate" validate:"gte=0" desc:"requests per second, unlimited when 0"`
+	Burst int     `mapstructure:"burst" validate:"gte=0" desc:"maximum burst of requests, the rate rounded up when 0"`
+}
+
+var DefaultConfig = wrappedCfg{
+	Tenant: Config{
+		Sources: []Source{
+			{Type: "header", Header: "x-tenant-id"},
+		},
+		TrustPropagated: true,
+		Skip:            []string{"/grpc.health.v1.Health/*", "/healthz", "/metrics"},
+	},
+}
+
+type wrappedCfg struct {
+	Tenant  Config                 `mapstructure:"tenant"`
+	Tenants map[string]interface{} `mapstructure:"tenants" desc:"config overrides by tenant ID, e.g. tenants.acme.tenant.rate-limit"`
+}
+
+func ReadConfig(v *viper.Viper) (Config, error) {
+	cfg := &wrappedCfg{}
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg.Tenant, nil
+}
+
+func CheckConfig(cfg Config) error {
+	if err := validator.New().Struct(&cfg); err != nil {
+		return err
+	}
+	return cfg.checkDefault()
+}
+
+// checkDefault checks the default tenant, which the validate rules of
+// cfg_module can't.
+func (cfg Config) checkDefault() error {
+	if cfg.Default != "" && !validID(strings.ToLower(cfg.Default)) {
+		return fmt.Errorf("invalid tenant.default: %q", cfg.Default)
+	}
+	return nil
+}
+
+// Module provides *Tenancy, which grpc_module and http_module use to
+// attribute requests to tenants, and *Overrides.
+func Module() fx.Option {
+	return fx.Options(
+		cfg_module.SetDefaultConfig(DefaultConfig),
+		fx.Provide(
+			ReadConfig,
+			NewOverrides,
+			NewTenancy,
+		),
+	)
+}
+
+// Errors of the rejected requests.
+var (
+	ErrTenantRequired = errorpb.Register(&errorpb.Definition{
+		ID:      "TENANT_REQUIRED",
+		Domain:  "tenant",
+		Code:    codes.InvalidArgument,
+		Message: "request is not attributed to a known tenant",
+	})
+	ErrTenantRateLimited = errorpb.Register(&errorpb.Definition{
+		ID:         "TENANT_RATE_LIMITED",
+		Domain:     "tenant",
+		Code:       codes.ResourceExhausted,
+		Message:    "rate limit of tenant %s is exceeded",
+		HTTPStatus: 429,
+	})
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tenant_requests_total",
+		Help: "Total number of requests by tenant, empty for requests without tenant, other for tenants that are not configured.",
+	}, []string{"transport", "tenant"})
+	rejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tenant_rejected_requests_total",
+		Help: "Total number of requests rejected by tenant and reason, unattributed or rate_limited, see tenant_requests_total.",
+	}, []string{"transport", "tenant", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, rejectedTotal)
+}
+
+// FromContext returns the tenant ID of ctx, empty if the request is not
+// attributed to a tenant.
+func FromContext(ctx context.Context) string {
+	return propagation_module.Value(ctx, Key)
+}
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+func validID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// maxLimiters bounds the rate limiters of the tenants that are not
+// configured, the least recently used one is evicted when it is reached.
+const maxLimiters = 10000
+
+type limiterEntry struct {
+	id string
+	l  *rate.Limiter
+}
+
+// Tenancy resolves the tenants of requests and enforces strict mode and
+// rate limits. A nil Tenancy attributes nothing.
+type Tenancy struct {
+	sources         []Source
+	known           map[string]bool
+	defaultTenant   string
+	strict          bool
+	trustPropagated bool
+	skip            *logfilter.Matcher
+	rateLimit       RateLimit
+	rateLimits      map[string]RateLimit
+
+	mu sync.Mutex
+	// limiters of configured tenants are kept, the others are in an LRU
+	configured map[string]*rate.Limiter
+	limiters   map[string]*list.Element
+	lru        *list.List
+
+	// edge holds the tenants of the requests checked by EchoMiddleware by
+	// one-time token, see EdgeHeader
+	edge sync.Map
+}
+
+// NewTenancy returns the Tenancy of cfg, the rate limits of tenants are
+// read from their overrides.
+func NewTenancy(cfg Config, overrides *Overrides) (*Tenancy, error) {
+	if err := cfg.checkDefault(); err != nil {
+		return nil, err
+	}
+	skip, err := logfilter.NewMatcher(cfg.Skip...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant.skip: %w", err)
+	}
+	t := &Tenancy{
+		sources:         cfg.Sources,
+		known:           map[string]bool{},
+		defaultTenant:   strings.ToLower(cfg.Default),
+		strict:          cfg.Strict,
+		trustPropagated: cfg.TrustPropagated,
+		skip:            skip,
+		rateLimit:       cfg.RateLimit,
+		rateLimits:      map[string]RateLimit{},
+		configured:      map[string]*rate.Limiter{},
+		limiters:        map[string]*list.Element{},
+		lru:             list.New(),
+	}
+	for _, id := range cfg.Known {
+		t.known[strings.ToLower(id)] = true
+	}
+	for _, id := range overrides.Tenants() {
+		tcfg, err := ReadConfig(overrides.Viper(id))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tenants.%s.tenant: %w", id, err)
+		}
+		t.rateLimits[id] = tcfg.RateLimit
+	}
+	return t, nil
+}
+
+// Skipped reports whether requests of the grpc full method or http paths
+// are not attributed to tenants.
+func (t *Tenancy) Skipped(names ...string) bool {
+	return t == nil || t.skip.Match(names...)
+}
+
+// Resolve returns the tenant ID of a request from the sources, or empty.
+// The path is empty for grpc calls.
+func (t *Tenancy) Resolve(host, path string, header func(name string) string) string {
+	if t == nil {
+		return ""
+	}
+	for _, s := range t.sources {
+		var id string
+		switch s.Type {
+		case "host":
+			id = hostTenant(host, s.Suffix)
+		case "header":
+			id = header(s.Header)
+		case "claim":
+			name := s.Header
+			if name == "" {
+				name = "authorization"
+			}
+			id = claimTenant(header(name), s.Claim)
+		case "path":
+			id = pathTenant(path, s.Prefix)
+		}
+		if id = strings.ToLower(strings.TrimSpace(id)); t.accepted(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+func (t *Tenancy) accepted(id string) bool {
+	return validID(id) && (len(t.known) == 0 || t.known[id])
+}
+
+func hostTenant(host, suffix string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	suffix = strings.ToLower(suffix)
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	label := strings.TrimSuffix(host, suffix)
+	if strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+func pathTenant(path, prefix string) string {
+	if prefix == "" {
+		prefix = "/"
+	}
+	if path == "" || !strings.HasPrefix(path, prefix) {
+		return ""
+	}
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+	return segment
+}
+
+// claimTenant returns the string claim of a bearer JWT, the token is not
+// verified, which is left to the authentication.
+func claimTenant(authorization, claim string) string {
+	token := authorization
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = token[7:]
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	id, _ := claims[claim].(string)
+	return id
+}
+
+type resolvedKey struct{}
+
+// resolution marks a context attributed by the server interceptors, edge
+// is set if the request was already checked by EchoMiddleware.
+type resolution struct {
+	edge bool
+}
+
+// attribute returns a copy of ctx attributed to the tenant id, the
+// propagated tenant if trusted, or the default tenant.
+func (t *Tenancy) attribute(ctx context.Context, id string) context.Context {
+	if id == "" && t.trustPropagated {
+		if propagated := strings.ToLower(FromContext(ctx)); t.accepted(propagated) {
+			id = propagated
+		}
+	}
+	if id == "" && !t.strict {
+		id = t.defaultTenant
+	}
+	// also drops an untrusted propagated tenant
+	ctx = propagation_module.WithValue(ctx, Key, id)
+	if id != "" {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", t.label(id)))
+	}
+	return context.WithValue(ctx, resolvedKey{}, resolution{})
+}
+
+// otherTenant labels the tenants that are not configured in metrics and
+// spans, since clients may send any valid ID when known is empty.
+const otherTenant = "other"
+
+// label returns id if it is configured, i.e. known, the default tenant or
+// overridden, otherwise otherTenant.
+func (t *Tenancy) label(id string) string {
+	if _, ok := t.rateLimits[id]; ok || t.known[id] || id == "" || id == t.defaultTenant {
+		return id
+	}
+	return otherTenant
+}
+
+// resolved reports whether ctx is attributed by the server interceptors,
+// and whether its request was checked by EchoMiddleware.
+func resolved(ctx context.Context) (ok, edge bool) {
+	r, ok := ctx.Value(resolvedKey{}).(resolution)
+	return ok, r.edge
+}
+
+// check counts the request of ctx and rejects it if it has no tenant in
+// strict mode, or if the rate limit of its tenant is exceeded.
+func (t *Tenancy) check(ctx context.Context, transport string) error {
+	id := FromContext(ctx)
+	if id == "" && t.strict {
+		rejectedTotal.WithLabelValues(transport, "", "unattributed").Inc()
+		return ErrTenantRequired.New()
+	}
+	label := t.label(id)
+	requestsTotal.WithLabelValues(transport, label).Inc()
+	if id == "" {
+		return nil
+	}
+	if l := t.limiter(id); l != nil && !l.Allow() {
+		rejectedTotal.WithLabelValues(transport, label, "rate_limited").Inc()
+		return ErrTenantRateLimited.New(id).WithRetryDelay(time.Duration(float64(time.Second) / float64(l.Limit())))
+	}
+	return nil
+}
+
+// limiter returns the rate limiter of the tenant id, nil if unlimited.
+func (t *Tenancy) limiter(id string) *rate.Limiter {
+	limit, ok := t.rateLimits[id]
+	if !ok {
+		limit = t.rateLimit
+	}
+	if limit.Rate <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.configured[id]; ok {
+		return l
+	}
+	if e, ok := t.limiters[id]; ok {
+		t.lru.MoveToFront(e)
+		return e.Value.(*limiterEntry).l
+	}
+	burst := limit.Burst
+	if burst == 0 {
+		burst = int(math.Ceil(limit.Rate))
+	}
+	l := rate.NewLimiter(rate.Limit(limit.Rate), burst)
+	if t.label(id) != otherTenant {
+		t.configured[id] = l
+		return l
+	}
+	if t.lru.Len() >= maxLimiters {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.limiters, oldest.Value.(*limiterEntry).id)
+	}
+	t.limiters[id] = t.lru.PushFront(&limiterEntry{id: id, l: l})
+	return l
+}
+
+// EdgeHeader is the metadata carrying the one-time token of a request
+// checked by EchoMiddleware to the calls of the clients created by
+// grpc_module.Dialer, e.g. the gateway calls on the loopback connection, so
+// that the server interceptors take its tenant and do not count and rate
+// limit it again. Tokens are random, used once and dropped at the end of
+// the request, so clients can't forge them.
+const EdgeHeader = "x-tenant-edge-token"
+
+type edgeKey struct{}
+
+// checkedAtEdge returns a copy of ctx carrying a new token of the tenant of
+// ctx, and the function dropping the token.
+func (t *Tenancy) checkedAtEdge(ctx context.Context) (context.Context, func()) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ctx, func() {}
+	}
+	token := hex.EncodeToString(b)
+	t.edge.Store(token, FromContext(ctx))
+	return context.WithValue(ctx, edgeKey{}, token), func() { t.edge.Delete(token) }
+}
+
+// edgeTenant returns the tenant of token and drops it.
+func (t *Tenancy) edgeTenant(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	id, ok := t.edge.LoadAndDelete(token)
+	if !ok {
+		return "", false
+	}
+	return id.(string), true
+}
@@ -0,0 +1,224 @@
+package tenant_module
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"pkg.lucas.icu/micro/errorpb"
+	"pkg.lucas.icu/micro/propagation_module"
+	"pkg.lucas.icu/micro/viperutil"
+)
+
+func newTenancy(t *testing.T, yaml string) (*Tenancy, *Overrides) {
+	t.Helper()
+	v := viper.New()
+	viperutil.VSetDefault(v, DefaultConfig)
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewOverrides(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenancy, err := NewTenancy(cfg, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tenancy, o
+}
+
+func TestResolve(t *testing.T) {
+	tenancy, _ := newTenancy(t, `
+tenant:
+  known: [acme, globex, initech, umbrella]
+  sources:
+    - type: host
+      suffix: .example.com
+    - type: claim
+      claim: tid
+    - type: path
+      prefix: /t/
+    - type: header
+      header: x-tenant-id
+`)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"tid":"Initech"}`))
+	for _, c := range []struct {
+		host, path string
+		header     http.Header
+		want       string
+	}{
+		{host: "acme.example.com:443", want: "acme"},
+		{host: "a.b.example.com", path: "/t/globex/users", want: "globex"},
+		{header: http.Header{"Authorization": {"Bearer h." + payload + ".s"}}, want: "initech"},
+		{header: http.Header{"X-Tenant-Id": {"UMBRELLA"}}, want: "umbrella"},
+		{header: http.Header{"X-Tenant-Id": {"unknown"}}, want: ""},
+		{path: "/t/", want: ""},
+	} {
+		if got := tenancy.Resolve(c.host, c.path, c.header.Get); got != c.want {
+			t.Errorf("Resolve(%q, %q, %v) = %q, want %q", c.host, c.path, c.header, got, c.want)
+		}
+	}
+}
+
+func TestTenancy(t *testing.T) {
+	tenancy, overrides := newTenancy(t, `
+welcome-message: hello
+tenant:
+  strict: true
+  rate-limit:
+    rate: 1
+tenants:
+  acme:
+    welcome-message: bonjour
+    tenant:
+      rate-limit:
+        rate: 2
+`)
+	if got := overrides.Viper("ACME").GetString("welcome-message"); got != "bonjour" {
+		t.Errorf("acme welcome-message = %q", got)
+	}
+	if got := overrides.Viper("globex").GetString("welcome-message"); got != "hello" {
+		t.Errorf("globex welcome-message = %q", got)
+	}
+
+	// untrusted propagated values are dropped
+	ctx := propagation_module.WithValue(context.Background(), Key, "BAD ID")
+	ctx = tenancy.attribute(ctx, "")
+	if id := FromContext(ctx); id != "" {
+		t.Errorf("FromContext() = %q", id)
+	}
+	if err := tenancy.check(ctx, "grpc"); !ErrTenantRequired.Is(err) {
+		t.Errorf("check() = %v, want TENANT_REQUIRED", err)
+	}
+
+	for tenant, allowed := range map[string]int{"acme": 2, "globex": 1} {
+		ctx := tenancy.attribute(context.Background(), tenant)
+		for i := 0; i <= allowed; i++ {
+			err := tenancy.check(ctx, "http")
+			if i < allowed && err != nil {
+				t.Errorf("%s request %d: check() = %v", tenant, i, err)
+			}
+			if i == allowed && !ErrTenantRateLimited.Is(err) {
+				t.Errorf("%s request %d: check() = %v, want TENANT_RATE_LIMITED", tenant, i, err)
+			}
+		}
+	}
+	for id, want := range map[string]string{"acme": "acme", "globex": otherTenant, "": ""} {
+		if got := tenancy.label(id); got != want {
+			t.Errorf("label(%q) = %q, want %q", id, got, want)
+		}
+	}
+	if e := errorpb.MustFromError(tenancy.check(tenancy.attribute(context.Background(), "acme"), "http")); e.Message != "rate limit of tenant acme is exceeded" {
+		t.Errorf("message = %q", e.Message)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	tenancy, _ := newTenancy(t, `
+tenant:
+  strict: true
+  trust-propagated: false
+  skip: []
+  rate-limit:
+    rate: 1
+    burst: 1
+`)
+	var seen []string
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		ResolveUnaryServerInterceptor(tenancy),
+		UnaryServerInterceptor(tenancy),
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			seen = append(seen, FromContext(ctx))
+			return handler(ctx, req)
+		},
+	))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the handler calls the grpc service like the gateway, without
+	// forwarding the tenant header
+	handler := EchoMiddleware(tenancy)(func(c echo.Context) error {
+		_, err := healthpb.NewHealthClient(conn).Check(c.Request().Context(), &healthpb.HealthCheckRequest{})
+		return err
+	})
+	e := echo.New()
+	for i, want := range []func(error) bool{
+		func(err error) bool { return err == nil },
+		ErrTenantRateLimited.Is,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+		req.Header.Set("X-Tenant-Id", "acme")
+		if err := handler(e.NewContext(req, httptest.NewRecorder())); !want(err) {
+			t.Errorf("request %d = %v", i, err)
+		}
+	}
+	if len(seen) != 1 || seen[0] != "acme" {
+		t.Errorf("grpc tenants = %v, want [acme]", seen)
+	}
+	if _, err := healthpb.NewHealthClient(conn).Check(
+		metadata.AppendToOutgoingContext(context.Background(), EdgeHeader, "forged"),
+		&healthpb.HealthCheckRequest{}); !ErrTenantRequired.Is(err) {
+		t.Errorf("call with a forged token = %v, want TENANT_REQUIRED", err)
+	}
+}
+
+func TestLimiterLRU(t *testing.T) {
+	tenancy, _ := newTenancy(t, `
+tenant:
+  known: [acme]
+  rate-limit:
+    rate: 1
+`)
+	acme := tenancy.limiter("acme")
+	first := tenancy.limiter("t0")
+	for i := 1; i < maxLimiters; i++ {
+		tenancy.limiter(fmt.Sprintf("t%d", i))
+	}
+	tenancy.limiter("t0")
+	tenancy.limiter("new")
+	if n := tenancy.lru.Len(); n != maxLimiters {
+		t.Errorf("%d limiters, want %d", n, maxLimiters)
+	}
+	if tenancy.limiter("t0") != first {
+		t.Error("recently used limiter is evicted")
+	}
+	if _, ok := tenancy.limiters["t1"]; ok {
+		t.Error("least recently used limiter is kept")
+	}
+	if tenancy.limiter("acme") != acme {
+		t.Error("limiter of a known tenant is evicted")
+	}
+}
@@ -0,0 +1,80 @@
+// Package timing records the time spent in the phases of a request, e.g.
+// database queries, for the slow request logs.
+//
+//	defer timing.Track(ctx, "db")()
+package timing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type phase struct {
+	name string
+	d    time.Duration
+}
+
+// Timer sums the durations of the phases of a request.
+// A nil Timer records nothing.
+type Timer struct {
+	mu     sync.Mutex
+	phases []phase
+}
+
+type timerKey struct{}
+
+// NewContext returns ctx with a new Timer.
+func NewContext(ctx context.Context) (context.Context, *Timer) {
+	t := &Timer{}
+	return context.WithValue(ctx, timerKey{}, t), t
+}
+
+// FromContext returns the Timer in ctx, or nil.
+func FromContext(ctx context.Context) *Timer {
+	t, _ := ctx.Value(timerKey{}).(*Timer)
+	return t
+}
+
+// Track starts the phase name of the request in ctx, the returned func ends it.
+func Track(ctx context.Context, name string) func() {
+	t := FromContext(ctx)
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.Add(name, time.Since(start))
+	}
+}
+
+// Add adds d to the phase name, the durations of a phase are summed.
+func (t *Timer) Add(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.phases {
+		if t.phases[i].name == name {
+			t.phases[i].d += d
+			return
+		}
+	}
+	t.phases = append(t.phases, phase{name: name, d: d})
+}
+
+// MarshalLogObject logs the phases in the order they started.
+func (t *Timer) MarshalLogObject(e zapcore.ObjectEncoder) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.phases {
+		e.AddDuration(p.name, p.d)
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"google.golang.org/api/option"
 	"pkg.lucas.icu/micro/cfg_module"
 	"pkg.lucas.icu/micro/svc_module"
+	"pkg.lucas.icu/micro/viperutil"
 )
 
 // Module requires ctx_module, log_module, svc_module if configured with stackdriver exporter
@@ -44,8 +45,8 @@ var DefaultConfig = wrappedCfg{
 }
 
 type Config struct {
-	Fraction float64 `mapstructure:"fraction"`
-	Driver   string  `mapstructure:"driver"`
+	Fraction float64 `mapstructure:"fraction" desc:"fraction of requests to sample"`
+	Driver   string  `mapstructure:"driver" desc:"trace exporter, none or stackdriver"`
 }
 
 type wrappedCfg struct {
@@ -54,7 +55,7 @@ type wrappedCfg struct {
 
 func ReadConfig(v *viper.Viper) (Config, error) {
 	cfg := &wrappedCfg{}
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
 		return Config{}, err
 	}
 	return cfg.Trace, nil
@@ -1,24 +1,26 @@
 package viperutil
 
 import (
+	"encoding"
+	"fmt"
+	"net/url"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
 func SetDefault(in interface{}) {
-	cfg, err := decode(in)
-	if err != nil {
-		panic(err)
-	}
-	mcfg, ok := cfg.(map[string]interface{})
-	if !ok {
-		panic("only support struct config")
-	}
-	for k, v := range mcfg {
-		viper.SetDefault(k, v)
-	}
+	VSetDefault(viper.GetViper(), in)
 }
 
 func VSetDefault(vp *viper.Viper, in interface{}) {
@@ -35,67 +37,191 @@ func VSetDefault(vp *viper.Viper, in interface{}) {
 	}
 }
 
-func decode(in interface{}) (_ interface{}, err error) {
-	if isStruct(in) {
-		out := map[string]interface{}{}
-		if err = mapstructure.Decode(in, &out); err != nil {
+// Unmarshal unmarshals the config of v into out with DecodeHook, which
+// v.Unmarshal does not apply by itself.
+func Unmarshal(v *viper.Viper, out interface{}, opts ...viper.DecoderConfigOption) error {
+	return v.Unmarshal(out, append([]viper.DecoderConfigOption{DecodeHook()}, opts...)...)
+}
+
+// DecodeHook returns the decode hooks for v.Unmarshal, so that the types
+// supported by Decode round-trip, see Unmarshal.
+func DecodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		stringToURLHookFunc(),
+		// before StringToSliceHookFunc, net.IP is a slice
+		mapstructure.TextUnmarshallerHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+}
+
+func stringToURLHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != urlType {
+			return data, nil
+		}
+		u, err := url.Parse(data.(string))
+		if err != nil {
 			return nil, err
 		}
-		for k, v := range out {
-			if isDecodable(v) {
-				if out[k], err = decode(v); err != nil {
-					return nil, err
-				}
-			}
+		return *u, nil
+	}
+}
+
+// Decode converts a config struct into the nested maps that viper keeps
+// its settings in.
+// Structs (with `squash` support), pointers, slices and maps are decoded
+// recursively, nil pointers are omitted. time.Duration, url.URL and
+// encoding.TextMarshaler types are kept as strings.
+func Decode(in interface{}) (interface{}, error) {
+	return decode(in)
+}
+
+func decode(in interface{}) (interface{}, error) {
+	return decodeValue(reflect.ValueOf(in))
+}
+
+func decodeValue(val reflect.Value) (_ interface{}, err error) {
+	if !val.IsValid() {
+		return nil, nil
+	}
+	if s, ok, err := marshalText(val); ok {
+		return s, err
+	}
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return nil, nil
+		}
+		return decodeValue(val.Elem())
+	case reflect.Struct:
+		out := map[string]interface{}{}
+		if err := decodeStruct(val, out); err != nil {
+			return nil, err
 		}
 		return out, nil
-	} else if isArrayOfStruct(in) {
-		val := reflect.ValueOf(in)
+	case reflect.Slice, reflect.Array:
+		if !IsTextType(val.Type().Elem()) && !isDecodable(val.Type().Elem()) {
+			// slices of scalars are kept as is
+			return val.Interface(), nil
+		}
 		out := make([]interface{}, val.Len())
 		for i := 0; i < val.Len(); i++ {
-			if out[i], err = decode(val.Index(i).Interface()); err != nil {
+			if out[i], err = decodeValue(val.Index(i)); err != nil {
 				return nil, err
 			}
 		}
 		return out, nil
-	} else if m, ok := in.(map[string]interface{}); ok {
-		for k, v := range m {
-			if m[k], err = decode(v); err != nil {
+	case reflect.Map:
+		if val.IsNil() {
+			return map[string]interface{}{}, nil
+		}
+		out := make(map[string]interface{}, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			k, _, err := marshalText(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if out[k], err = decodeValue(iter.Value()); err != nil {
 				return nil, err
 			}
 		}
-		return m, nil
+		return out, nil
 	}
-	return in, nil
+	return val.Interface(), nil
 }
 
-func isDecodable(v interface{}) bool {
-	typ := reflect.TypeOf(v)
-	if typ.Kind() == reflect.Slice {
-		typ = typ.Elem()
+func decodeStruct(val reflect.Value, out map[string]interface{}) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "-" || (!field.IsExported() && !strings.Contains(opts, "squash")) {
+			continue
+		}
+		fv := val.Field(i)
+		if strings.Contains(opts, "squash") {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() != reflect.Struct {
+				return fmt.Errorf("cannot squash non-struct field %s", field.Name)
+			}
+			if err := decodeStruct(fv, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if (fv.Kind() == reflect.Ptr && fv.IsNil()) || (strings.Contains(opts, "omitempty") && fv.IsZero()) {
+			continue
+		}
+		v, err := decodeValue(fv)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		out[name] = v
 	}
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
+	return nil
+}
+
+// marshalText converts text types into strings, ok is false for other types
+// except that map keys are always formatted as strings.
+func marshalText(val reflect.Value) (_ string, ok bool, err error) {
+	typ := val.Type()
+	switch {
+	case typ == durationType:
+		return time.Duration(val.Int()).String(), true, nil
+	case typ == urlType:
+		u := val.Interface().(url.URL)
+		return u.String(), true, nil
+	case typ.Implements(textMarshalerType):
+		if typ.Kind() == reflect.Ptr && val.IsNil() {
+			return "", false, nil
+		}
+		b, err := val.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), true, err
+	case reflect.PtrTo(typ).Implements(textMarshalerType):
+		ptr := reflect.New(typ)
+		ptr.Elem().Set(val)
+		b, err := ptr.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), true, err
+	case typ.Kind() == reflect.String:
+		return val.String(), false, nil
 	}
-	return typ.Kind() == reflect.Struct || typ.Kind() == reflect.Map
+	return fmt.Sprint(val.Interface()), false, nil
 }
 
-func isStruct(v interface{}) bool {
-	typ := reflect.TypeOf(v)
-	if typ.Kind() == reflect.Ptr {
+// IsTextType reports whether the values of typ are configured as strings
+// though typ is not a string, e.g. time.Duration, url.URL and net.IP.
+func IsTextType(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
-	return typ.Kind() == reflect.Struct
+	if typ.Kind() == reflect.String {
+		return false
+	}
+	return typ == durationType || typ == urlType ||
+		typ.Implements(textMarshalerType) || reflect.PtrTo(typ).Implements(textMarshalerType) ||
+		reflect.PtrTo(typ).Implements(textUnmarshalerType)
 }
 
-func isArrayOfStruct(v interface{}) bool {
-	typ := reflect.TypeOf(v)
-	if typ.Kind() == reflect.Slice {
+func isDecodable(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
-		if typ.Kind() == reflect.Ptr {
-			typ = typ.Elem()
-		}
-		return typ.Kind() == reflect.Struct
+	}
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Interface, reflect.Slice, reflect.Array:
+		return true
 	}
 	return false
 }
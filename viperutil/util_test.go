@@ -0,0 +1,89 @@
+package viperutil
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "high"}[l]), nil
+}
+
+func (l *level) UnmarshalText(b []byte) error {
+	*l = level(strings.Index("lowhigh", string(b)) / 3)
+	return nil
+}
+
+type common struct {
+	Name string `mapstructure:"name"`
+}
+
+type backend struct {
+	Addr    net.IP        `mapstructure:"addr"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type testCfg struct {
+	common   `mapstructure:",squash"`
+	Endpoint url.URL            `mapstructure:"endpoint"`
+	Level    level              `mapstructure:"level"`
+	Backends map[string]backend `mapstructure:"backends"`
+	Primary  *backend           `mapstructure:"primary"`
+	Fallback *backend           `mapstructure:"fallback"`
+	Tags     []string           `mapstructure:"tags"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := testCfg{
+		common:   common{Name: "svc"},
+		Endpoint: url.URL{Scheme: "https", Host: "example.com", Path: "/api"},
+		Level:    1,
+		Backends: map[string]backend{
+			"db": {Addr: net.ParseIP("10.0.0.1"), Timeout: 3 * time.Second},
+		},
+		Primary: &backend{Addr: net.ParseIP("10.0.0.2"), Timeout: time.Minute},
+		Tags:    []string{"a", "b"},
+	}
+
+	v := viper.New()
+	VSetDefault(v, in)
+
+	if got := v.GetString("name"); got != "svc" {
+		t.Errorf("squashed name = %q", got)
+	}
+	if got := v.GetString("backends.db.timeout"); got != "3s" {
+		t.Errorf("backends.db.timeout = %q", got)
+	}
+	if got := v.GetString("endpoint"); got != "https://example.com/api" {
+		t.Errorf("endpoint = %q", got)
+	}
+	if v.IsSet("fallback") {
+		t.Error("nil pointer should not be set")
+	}
+
+	// override a nested value the way a config file would
+	if err := v.MergeConfigMap(map[string]interface{}{
+		"backends": map[string]interface{}{"db": map[string]interface{}{"timeout": "5s"}},
+		"level":    "low",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := testCfg{}
+	if err := Unmarshal(v, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Backends["db"] = backend{Addr: in.Backends["db"].Addr, Timeout: 5 * time.Second}
+	in.Level = 0
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n got: %+v\nwant: %+v", out, in)
+	}
+}
@@ -13,21 +13,27 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"pkg.lucas.icu/micro/cfg_module"
+	"pkg.lucas.icu/micro/redact"
 	"pkg.lucas.icu/micro/svc_module"
 	"pkg.lucas.icu/micro/version"
+	"pkg.lucas.icu/micro/viperutil"
 )
 
 var DefaultConfig = wrappedCfg{
 	Log: Config{
-		Driver: "development",
-		Level:  "debug",
+		Driver:    "development",
+		Level:     "debug",
+		Redaction: redact.DefaultConfig,
 	},
 }
 
 type Config struct {
-	Driver       string `mapstructure:"driver"` // development, stackdriver
-	Level        string `mapstructure:"level"`  // debug, info, warn, error, panic, fatal
-	SlackWebhook string `mapstructure:"slack-webhook" validate:"omitempty,url"`
+	Driver       string `mapstructure:"driver" desc:"log driver, development or stackdriver"`
+	Level        string `mapstructure:"level" desc:"minimum log level, debug, info, warn, error, panic or fatal"`
+	SlackWebhook string `mapstructure:"slack-webhook" validate:"omitempty,url" sensitive:"true" desc:"slack webhook to send error logs to"`
+
+	// Redaction masks sensitive values of the payloads logged by the http and grpc request loggers.
+	Redaction redact.Config `mapstructure:"redaction"`
 }
 
 type wrappedCfg struct {
@@ -36,7 +42,7 @@ type wrappedCfg struct {
 
 func ReadConfig(v *viper.Viper) (Config, error) {
 	cfg := &wrappedCfg{}
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := viperutil.Unmarshal(v, &cfg); err != nil {
 		return Config{}, err
 	}
 	return cfg.Log, nil
@@ -52,9 +58,9 @@ func Module() fx.Option {
 		fx.Provide(
 			ReadConfig,
 			newLogger,
+			newRedactor,
 		),
 		fx.Invoke(
-			CheckConfig,
 			ReplaceGlobalLogger,
 		),
 	)
@@ -153,6 +159,14 @@ func newLogger(lc fx.Lifecycle, cfg Config, serviceParams svc_module.OptionalCon
 	return logger, err
 }
 
+func newRedactor(cfg Config) (*redact.Redactor, error) {
+	r, err := redact.New(cfg.Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log.redaction: %w", err)
+	}
+	return r, nil
+}
+
 func ReplaceGlobalLogger(l *zap.Logger) {
 	zap.ReplaceGlobals(l)
 }